@@ -0,0 +1,194 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// capacityReservationPlatforms maps the platforms of the capacity reservations to the operating system and pre-installed
+// software of their products. Platforms missing here can't be priced.
+var capacityReservationPlatforms = map[ec2types.CapacityReservationInstancePlatform][2]string{
+	ec2types.CapacityReservationInstancePlatformLinuxUnix:                      {"Linux", "NA"},
+	ec2types.CapacityReservationInstancePlatformRedHatEnterpriseLinux:          {"RHEL", "NA"},
+	ec2types.CapacityReservationInstancePlatformSuseLinux:                      {"SUSE", "NA"},
+	ec2types.CapacityReservationInstancePlatformWindows:                        {"Windows", "NA"},
+	ec2types.CapacityReservationInstancePlatformWindowsWithSqlServerEnterprise: {"Windows", "SQL Ent"},
+	ec2types.CapacityReservationInstancePlatformWindowsWithSqlServerStandard:   {"Windows", "SQL Std"},
+	ec2types.CapacityReservationInstancePlatformWindowsWithSqlServerWeb:        {"Windows", "SQL Web"},
+	ec2types.CapacityReservationInstancePlatformLinuxWithSqlServerEnterprise:   {"Linux", "SQL Ent"},
+	ec2types.CapacityReservationInstancePlatformLinuxWithSqlServerStandard:     {"Linux", "SQL Std"},
+	ec2types.CapacityReservationInstancePlatformLinuxWithSqlServerWeb:          {"Linux", "SQL Web"},
+	ec2types.CapacityReservationInstancePlatformRhelWithSqlServerEnterprise:    {"RHEL", "SQL Ent"},
+	ec2types.CapacityReservationInstancePlatformRhelWithSqlServerStandard:      {"RHEL", "SQL Std"},
+	ec2types.CapacityReservationInstancePlatformRhelWithSqlServerWeb:           {"RHEL", "SQL Web"},
+}
+
+// idleReservation groups the idle instances of the active capacity reservations priced the same.
+type idleReservation struct {
+	instanceType     string
+	availabilityZone string
+	operatingSystem  string
+	software         string
+	tenancy          string
+}
+
+// capacityReservationSource exports the hourly cost of the idle instances of the capacity reservations of the account,
+// priced at the UnusedCapacityReservation ondemand rate.
+type capacityReservationSource struct {
+	*productsFetcher
+}
+
+func init() {
+	RegisterPriceSource("capacityreservation", newCapacityReservationSource)
+}
+
+func newCapacityReservationSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("capacityreservation", contains(cfg.CapacityStatuses, "UnusedCapacityReservation")) {
+		return nil
+	}
+
+	return &capacityReservationSource{
+		productsFetcher: newProductsFetcher(cfg),
+	}
+}
+
+func (s *capacityReservationSource) Name() string {
+	return "capacityreservation"
+}
+
+// FetchRegion returns the number of idle instances of the capacity reservations of the region and their hourly cost,
+// per instance type, availability zone, operating system and tenancy.
+func (s *capacityReservationSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	idle, err := getIdleReservations(ctx, cfg, region)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(idle) == 0 {
+		return []PriceRecord{}, nil
+	}
+
+	products := make(map[idleReservation]bool)
+	queries := make([][]priceFilter, 0, len(idle))
+	for reservation := range idle {
+		if products[reservation.product()] {
+			continue
+		}
+		products[reservation.product()] = true
+		queries = append(queries, append(
+			productFilters(reservation.operatingSystem, reservation.software, reservation.tenancy, "UnusedCapacityReservation"),
+			priceFilter{field: "instanceType", value: reservation.instanceType},
+			priceFilter{field: "licenseModel", value: validLicenseModels[reservation.operatingSystem][0]},
+		))
+	}
+
+	outs, err := s.fetchProducts(ctx, region, queries)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[idleReservation]float64)
+	// the prices of a price list share the currency
+	var currency string
+	for _, out := range outs {
+		product := idleReservation{
+			instanceType:    out.Product.Attributes["instanceType"],
+			operatingSystem: out.Product.Attributes["operatingSystem"],
+			software:        out.Product.Attributes["preInstalledSw"],
+			tenancy:         out.Product.Attributes["tenancy"],
+		}
+		value, valueCurrency, err := onDemandPrice(out)
+		if err != nil {
+			log.WithError(err).Errorf("error while parsing capacity reservation price value from API response [region=%s, type=%s]", region, product.instanceType)
+			continue
+		}
+		prices[product] = value
+		currency = valueCurrency
+	}
+
+	records := make([]PriceRecord, 0, 2*len(idle))
+	for reservation, count := range idle {
+		record := PriceRecord{
+			Name:                 "ec2_capacity_reservation_idle_instances",
+			Value:                float64(count),
+			Region:               region,
+			AvailabilityZone:     reservation.availabilityZone,
+			InstanceType:         reservation.instanceType,
+			Tenancy:              reservation.tenancy,
+			OperatingSystem:      reservation.operatingSystem,
+			PreInstalledSoftware: reservation.software,
+		}
+		records = append(records, record)
+
+		price, ok := prices[reservation.product()]
+		if !ok {
+			log.Warnf("no price found for capacity reservation [region=%s, type=%s, os=%s, tenancy=%s]", region, reservation.instanceType, reservation.operatingSystem, reservation.tenancy)
+			continue
+		}
+		record.Name = "ec2_capacity_reservation_idle_cost"
+		record.Value = float64(count) * price
+		record.Currency = currency
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// product returns the reservation without its availability zone, the products are priced per region.
+func (r idleReservation) product() idleReservation {
+	r.availabilityZone = ""
+	return r
+}
+
+// getIdleReservations returns the number of available instances of the active capacity reservations of the region.
+func getIdleReservations(ctx context.Context, cfg aws.Config, region string) (map[idleReservation]int32, error) {
+	ec2Svc := ec2.NewFromConfig(cfg)
+	pag := ec2.NewDescribeCapacityReservationsPaginator(ec2Svc, &ec2.DescribeCapacityReservationsInput{
+		MaxResults: aws.Int32(AwsMaxResultsPerPage),
+		Filters: []ec2types.Filter{
+			{
+				Name:   aws.String("state"),
+				Values: []string{string(ec2types.CapacityReservationStateActive)},
+			},
+		},
+	})
+
+	idle := make(map[idleReservation]int32)
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error while describing capacity reservations: %w", err)
+		}
+
+		for _, reservation := range page.CapacityReservations {
+			if aws.ToInt32(reservation.AvailableInstanceCount) == 0 {
+				continue
+			}
+			platform, ok := capacityReservationPlatforms[reservation.InstancePlatform]
+			if !ok {
+				log.Debugf("Skipping capacity reservation of unsupported platform [region=%s, id=%s, platform=%s]", region, aws.ToString(reservation.CapacityReservationId), reservation.InstancePlatform)
+				continue
+			}
+
+			tenancy := "Shared"
+			if reservation.Tenancy == ec2types.CapacityReservationTenancyDedicated {
+				tenancy = "Dedicated"
+			}
+
+			idle[idleReservation{
+				instanceType:     aws.ToString(reservation.InstanceType),
+				availabilityZone: aws.ToString(reservation.AvailabilityZone),
+				operatingSystem:  platform[0],
+				software:         platform[1],
+				tenancy:          tenancy,
+			}] += aws.ToInt32(reservation.AvailableInstanceCount)
+		}
+	}
+
+	return idle, nil
+}
@@ -0,0 +1,390 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	validProductDescriptions       = []string{"Linux/UNIX", "SUSE Linux", "Windows", "Linux/UNIX (Amazon VPC)", "SUSE Linux (Amazon VPC)", "Windows (Amazon VPC)"}
+	validOperatingSystems          = []string{"Linux", "RHEL", "SUSE", "Windows"}
+	validTenancies                 = []string{"Shared", "Dedicated", "Host"}
+	defaultTenancies               = []string{"Shared"}
+	validCapacityStatuses          = []string{"Used", "UnusedCapacityReservation", "AllocatedCapacityReservation"}
+	defaultCapacityStatuses        = []string{"Used"}
+	validLifecycles                = []string{"spot", "ondemand", "reserved"}
+	defaultLifecycles              = []string{"spot", "ondemand"}
+	validSavingPlanTypes           = []string{"Compute", "EC2Instance", "SageMaker"}
+	defaultSpotPlacementCapacities = []int32{1}
+	validEBSVolumeTypes            = []string{"gp2", "gp3", "io1", "io2", "st1", "sc1", "standard"}
+	// instanceTypeName matches the names of the instance types, e.g. m5.large or u-6tb1.metal, and no wildcards.
+	instanceTypeName = regexp.MustCompile(`^[a-z0-9-]+\.[a-z0-9-]+$`)
+	// validPreInstalledSoftware is the pre-installed software available with each operating system.
+	validPreInstalledSoftware = map[string][]string{
+		"Linux":   {"NA", "SQL Std", "SQL Web", "SQL Ent"},
+		"RHEL":    {"NA", "SQL Std", "SQL Web", "SQL Ent"},
+		"SUSE":    {"NA"},
+		"Windows": {"NA", "SQL Std", "SQL Web", "SQL Ent"},
+	}
+	defaultPreInstalledSoftware = []string{"NA"}
+	// validLicenseModels are the license models available with each operating system.
+	validLicenseModels = map[string][]string{
+		"Linux":   {"No License required"},
+		"RHEL":    {"No License required"},
+		"SUSE":    {"No License required"},
+		"Windows": {"License Included", "Bring your own license"},
+	}
+)
+
+// Config holds the settings of the exporter, it is also handed to the price source factories.
+// It is built from the command line flags and optionally overlaid by a YAML configuration file, see LoadConfigFile.
+type Config struct {
+	ProductDescriptions []string      `yaml:"product_descriptions"`
+	OperatingSystems    []string      `yaml:"operating_systems"`
+	Regions             []string      `yaml:"regions"`
+	Lifecycle           []string      `yaml:"lifecycle"`
+	InstanceRegexes     []string      `yaml:"instance_regexes"`
+	SavingPlanTypes     []string      `yaml:"saving_plan_types"`
+	RefreshInterval     time.Duration `yaml:"refresh_interval"`
+	// Tenancies are the tenancies (Shared, Dedicated, Host) of the ondemand, reserved and saving plan prices. Host only
+	// exports the price of the dedicated hosts per host family, from the ondemand source.
+	Tenancies []string `yaml:"tenancies"`
+	// PreInstalledSoftware is the software pre-installed on the ondemand and reserved instances (NA, SQL Std, SQL Web, SQL Ent).
+	PreInstalledSoftware []string `yaml:"pre_installed_software"`
+	// LicenseModels filters the ondemand and reserved prices by license model, empty keeps all of them.
+	LicenseModels []string `yaml:"license_models"`
+	// CapacityStatuses are the capacity statuses (Used, UnusedCapacityReservation, AllocatedCapacityReservation) of the
+	// ondemand and reserved prices. With UnusedCapacityReservation, the cost of the idle capacity reservations is exported too.
+	CapacityStatuses []string `yaml:"capacity_statuses"`
+	// EBSVolumeTypes are the EBS volume types to get pricing for, empty disables the ebs source.
+	EBSVolumeTypes []string `yaml:"ebs_volume_types"`
+	// Fargate enables the fargate source, pricing the Fargate vCPU and memory.
+	Fargate bool `yaml:"fargate"`
+	// SpotPlacementCapacities are the target capacities (number of instances) of the Spot placement scores, empty
+	// disables the spotplacement source.
+	SpotPlacementCapacities []int32 `yaml:"spot_placement_target_capacities"`
+	// SpotPlacementInstanceTypes are the instance types of the Spot placement scores, required by the spotplacement
+	// source. They are named explicitly, up to MaxSpotPlacementInstanceTypes, the instance regexes don't apply.
+	SpotPlacementInstanceTypes []string `yaml:"spot_placement_instance_types"`
+	// SpotPlacementInterval is how often the Spot placement scores are fetched again, they are cached in between.
+	SpotPlacementInterval time.Duration `yaml:"spot_placement_interval"`
+	// SpotAdvisorData is the URL or the path of the Spot Instance Advisor dataset (spot-advisor-data.json), empty
+	// disables the spotadvisor source.
+	SpotAdvisorData string `yaml:"spot_advisor_data"`
+	// SpotHistoryWindow is the lookback window of the spot price statistics, 0 disables them.
+	SpotHistoryWindow time.Duration `yaml:"spot_history_window"`
+	// LegacyLabels keeps the product_description and operating_system labels replaced by the platform label.
+	LegacyLabels bool `yaml:"legacy_labels"`
+	// PartitionProfiles are the AWS shared config profiles holding the credentials of the partitions (aws, aws-cn,
+	// aws-us-gov), partitions without a profile use the default credential chain.
+	PartitionProfiles map[string]string `yaml:"partition_profiles"`
+	// LocalZones adds the opted-in Local Zones to the availability zones of the regions.
+	LocalZones bool `yaml:"local_zones"`
+	// OnDemandRegionOnly exports the ondemand prices per region, without the availability_zone label.
+	OnDemandRegionOnly bool `yaml:"ondemand_region_only"`
+	// NormalizationModel splits the instance prices between vcpu, memory and GPUs: ratio, fitted or gpu.
+	NormalizationModel string `yaml:"normalization_model"`
+	// CPUMemoryRatio is the cost of a vcpu in GB of memory of the ratio model, and the fallback of the fitted ones.
+	CPUMemoryRatio float64 `yaml:"cpu_memory_ratio"`
+	// InstanceTypesRefreshInterval is how often the instance type catalog of every region is fetched again.
+	InstanceTypesRefreshInterval time.Duration `yaml:"instance_types_refresh_interval"`
+	// MaxStaleness is how long the last good prices of a region are served after its fetches started failing, 0 keeps them forever.
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+	// Concurrency is the maximum number of region fetches running at once.
+	Concurrency int `yaml:"concurrency"`
+	// ServiceConcurrency additionally limits the concurrent fetches per AWS service (e.g. pricing), the Pricing API throttles hard.
+	ServiceConcurrency map[string]int `yaml:"service_concurrency"`
+	// SnapshotFile is where the prices are persisted after every refresh and loaded from at startup, empty disables it.
+	SnapshotFile string `yaml:"snapshot_file"`
+	// OfferFiles is a directory or an URL holding the AWS Price List bulk offer files of AmazonEC2. When set, the ondemand
+	// prices are read from the offer files instead of the Pricing API.
+	OfferFiles string `yaml:"offer_files"`
+	// OfferFilesFormat is the format of the region offer files, json or csv.
+	OfferFilesFormat string `yaml:"offer_files_format"`
+	// Sources holds the per-source options, keyed by source name.
+	Sources map[string]SourceConfig `yaml:"sources"`
+
+	instanceRegexes []*regexp.Regexp
+	// awsConfigs are the AWS configs of the partitions, loaded by the exporter
+	awsConfigs map[string]aws.Config
+}
+
+// SourceConfig holds the options of a single price source.
+type SourceConfig struct {
+	// Enabled overrides whether the source is enabled, by default it follows lifecycle and saving_plan_types.
+	Enabled *bool `yaml:"enabled"`
+	// Regions limits the source to a subset of the exporter regions.
+	Regions []string `yaml:"regions"`
+	// MaxStaleness overrides the exporter max staleness for the source, 0 keeps its prices forever. Unset, the source
+	// inherits the exporter max staleness.
+	MaxStaleness *time.Duration `yaml:"max_staleness"`
+}
+
+// LoadConfigFile overlays the YAML configuration file on top of the base configuration and validates the result.
+// Settings missing in the file keep their base value.
+func LoadConfigFile(path string, base Config) (Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("error while reading config file %s: %w", path, err)
+	}
+
+	cfg := base
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("error while parsing config file %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate applies the defaults of empty settings and checks the configuration.
+func (c *Config) Validate() error {
+	if len(c.Lifecycle) == 0 {
+		c.Lifecycle = defaultLifecycles
+	}
+	if len(c.Tenancies) == 0 {
+		c.Tenancies = defaultTenancies
+	}
+	if len(c.PreInstalledSoftware) == 0 {
+		c.PreInstalledSoftware = defaultPreInstalledSoftware
+	}
+	if len(c.CapacityStatuses) == 0 {
+		c.CapacityStatuses = defaultCapacityStatuses
+	}
+	if len(c.InstanceRegexes) == 0 {
+		c.InstanceRegexes = []string{".*"}
+	}
+	if c.OfferFilesFormat == "" {
+		c.OfferFilesFormat = OfferFormatJSON
+	}
+	if c.InstanceTypesRefreshInterval == 0 {
+		c.InstanceTypesRefreshInterval = DefaultInstanceTypesRefreshInterval
+	}
+	if c.SpotPlacementInterval == 0 {
+		c.SpotPlacementInterval = DefaultSpotPlacementInterval
+	}
+	if c.NormalizationModel == "" {
+		c.NormalizationModel = NormalizationRatio
+	}
+	if c.CPUMemoryRatio == 0 {
+		c.CPUMemoryRatio = DefaultCPUMemoryRatio
+	}
+
+	if err := validateValues("product description", c.ProductDescriptions, validProductDescriptions); err != nil {
+		return err
+	}
+	if !c.LegacyLabels {
+		if err := validatePlatforms(c.ProductDescriptions); err != nil {
+			return err
+		}
+	}
+	if err := validateValues("operating system", c.OperatingSystems, validOperatingSystems); err != nil {
+		return err
+	}
+	if err := validateCombinations("pre-installed software", c.PreInstalledSoftware, c.OperatingSystems, validPreInstalledSoftware); err != nil {
+		return err
+	}
+	if err := validateCombinations("license model", c.LicenseModels, c.OperatingSystems, validLicenseModels); err != nil {
+		return err
+	}
+	if err := validateValues("tenancy", c.Tenancies, validTenancies); err != nil {
+		return err
+	}
+	if err := validateValues("capacity status", c.CapacityStatuses, validCapacityStatuses); err != nil {
+		return err
+	}
+	if err := validateValues("lifecycle", c.Lifecycle, validLifecycles); err != nil {
+		return err
+	}
+	if err := validateValues("saving plan type", c.SavingPlanTypes, validSavingPlanTypes); err != nil {
+		return err
+	}
+	if err := validateValues("ebs volume type", c.EBSVolumeTypes, validEBSVolumeTypes); err != nil {
+		return err
+	}
+	if err := validateValues("normalization model", []string{c.NormalizationModel}, validNormalizationModels); err != nil {
+		return err
+	}
+
+	c.instanceRegexes = make([]*regexp.Regexp, len(c.InstanceRegexes))
+	for i, r := range c.InstanceRegexes {
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return fmt.Errorf("invalid instance regex %s: %s", r, err)
+		}
+		c.instanceRegexes[i] = re
+	}
+
+	if c.OfferFilesFormat != OfferFormatJSON && c.OfferFilesFormat != OfferFormatCSV {
+		return fmt.Errorf("offer files format '%s' is not recognized. Available values: %s, %s", c.OfferFilesFormat, OfferFormatJSON, OfferFormatCSV)
+	}
+
+	if c.RefreshInterval <= 0 {
+		return fmt.Errorf("refresh interval must be positive, got %s", c.RefreshInterval)
+	}
+	if c.CPUMemoryRatio < 0 {
+		return fmt.Errorf("cpu memory ratio must be positive, got %v", c.CPUMemoryRatio)
+	}
+	if c.InstanceTypesRefreshInterval < 0 {
+		return fmt.Errorf("instance types refresh interval must be positive, got %s", c.InstanceTypesRefreshInterval)
+	}
+	if c.SpotPlacementInterval < 0 {
+		return fmt.Errorf("spot placement interval must be positive, got %s", c.SpotPlacementInterval)
+	}
+	if c.SpotHistoryWindow < 0 {
+		return fmt.Errorf("spot history window must not be negative, got %s", c.SpotHistoryWindow)
+	}
+	if c.MaxStaleness < 0 {
+		return fmt.Errorf("max staleness must not be negative, got %s", c.MaxStaleness)
+	}
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("concurrency must be positive, got %d", c.Concurrency)
+	}
+	for _, capacity := range c.SpotPlacementCapacities {
+		if capacity <= 0 {
+			return fmt.Errorf("spot placement target capacity must be positive, got %d", capacity)
+		}
+	}
+	if err := c.validateSpotPlacementInstanceTypes(); err != nil {
+		return err
+	}
+	for partition := range c.PartitionProfiles {
+		if !contains(validPartitions, partition) {
+			return fmt.Errorf("partition '%s' is not recognized. Available values: %v", partition, validPartitions)
+		}
+	}
+	for service, limit := range c.ServiceConcurrency {
+		if limit <= 0 {
+			return fmt.Errorf("concurrency of service %s must be positive, got %d", service, limit)
+		}
+	}
+
+	for name, source := range c.Sources {
+		if !isRegisteredSource(name) {
+			return fmt.Errorf("source '%s' is not recognized. Available sources: %v", name, registeredSources())
+		}
+		if source.MaxStaleness != nil && *source.MaxStaleness < 0 {
+			return fmt.Errorf("max staleness of source %s must not be negative, got %s", name, *source.MaxStaleness)
+		}
+	}
+
+	return nil
+}
+
+// SourceEnabled tells whether the source is enabled, taking the per-source enabled option over the default.
+func (c Config) SourceEnabled(name string, byDefault bool) bool {
+	if source, ok := c.Sources[name]; ok && source.Enabled != nil {
+		return *source.Enabled
+	}
+	return byDefault
+}
+
+// MatchInstanceType tells whether the instance type matches any of the configured instance regexes.
+func (c Config) MatchInstanceType(instanceType string) bool {
+	return isMatchAny(c.instanceRegexes, instanceType)
+}
+
+// sourceInRegion tells whether the source should be fetched in the region.
+func (c Config) sourceInRegion(name, region string) bool {
+	source, ok := c.Sources[name]
+	if !ok || len(source.Regions) == 0 {
+		return true
+	}
+	return contains(source.Regions, region)
+}
+
+// sourceMaxStaleness returns the max staleness of the source, 0 when its prices are kept forever.
+func (c Config) sourceMaxStaleness(name string) time.Duration {
+	if source, ok := c.Sources[name]; ok && source.MaxStaleness != nil {
+		return *source.MaxStaleness
+	}
+	return c.MaxStaleness
+}
+
+func validateValues(kind string, values []string, valid []string) error {
+	for _, v := range values {
+		if !contains(valid, v) {
+			return fmt.Errorf("%s '%s' is not recognized. Available values: %v", kind, v, valid)
+		}
+	}
+	return nil
+}
+
+// validateSpotPlacementInstanceTypes checks that the spotplacement source, when enabled, names its instance types.
+// AWS limits the number of score configurations requested within 24 hours, a wildcard would request them all.
+func (c Config) validateSpotPlacementInstanceTypes() error {
+	if !c.SourceEnabled("spotplacement", len(c.SpotPlacementCapacities) != 0) {
+		return nil
+	}
+	if len(c.SpotPlacementInstanceTypes) == 0 {
+		return fmt.Errorf("spot placement instance types are required by the spotplacement source")
+	}
+	if len(c.SpotPlacementInstanceTypes) > MaxSpotPlacementInstanceTypes {
+		return fmt.Errorf("at most %d spot placement instance types are allowed, got %d", MaxSpotPlacementInstanceTypes, len(c.SpotPlacementInstanceTypes))
+	}
+	for _, instanceType := range c.SpotPlacementInstanceTypes {
+		if !instanceTypeName.MatchString(instanceType) {
+			return fmt.Errorf("spot placement instance type '%s' is not an instance type name, e.g. m5.large", instanceType)
+		}
+	}
+	return nil
+}
+
+// validatePlatforms checks that no two product descriptions map to the same platform, e.g. Linux/UNIX and
+// Linux/UNIX (Amazon VPC). Without the legacy labels, their prices would get the same labels.
+func validatePlatforms(productDescriptions []string) error {
+	seen := make(map[string]string, len(productDescriptions))
+	for _, description := range productDescriptions {
+		platform := platforms[description]
+		if other, ok := seen[platform]; ok && other != description {
+			return fmt.Errorf("product descriptions '%s' and '%s' are both exported as platform %s, keep one of them or enable the legacy labels", other, description, platform)
+		}
+		seen[platform] = description
+	}
+	return nil
+}
+
+// validateCombinations checks that every value is available with at least one of the operating systems. Combinations
+// that don't exist are skipped when querying the prices.
+func validateCombinations(kind string, values []string, operatingSystems []string, valid map[string][]string) error {
+	all := make([]string, 0)
+	for _, os := range validOperatingSystems {
+		for _, v := range valid[os] {
+			if !contains(all, v) {
+				all = append(all, v)
+			}
+		}
+	}
+
+	for _, v := range values {
+		available := make([]string, 0)
+		for _, os := range validOperatingSystems {
+			if contains(valid[os], v) {
+				available = append(available, os)
+			}
+		}
+		if len(available) == 0 {
+			return fmt.Errorf("%s '%s' is not recognized. Available values: %v", kind, v, all)
+		}
+
+		matched := false
+		for _, os := range operatingSystems {
+			matched = matched || contains(available, os)
+		}
+		if !matched {
+			return fmt.Errorf("%s '%s' is not available for operating systems %v. Available with: %v", kind, v, operatingSystems, available)
+		}
+	}
+	return nil
+}
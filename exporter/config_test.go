@@ -0,0 +1,82 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSourceMaxStaleness(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   time.Duration
+	}{
+		{name: "inherited", config: "sources: {spot: {regions: [eu-west-1]}}", want: time.Hour},
+		{name: "overridden", config: "sources: {spot: {max_staleness: 48h}}", want: 48 * time.Hour},
+		{name: "forever", config: "sources: {spot: {max_staleness: 0s}}", want: 0},
+		{name: "no source options", config: "{}", want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{MaxStaleness: time.Hour}
+			if err := yaml.Unmarshal([]byte(tt.config), &cfg); err != nil {
+				t.Fatalf("unmarshal error = %v", err)
+			}
+			if got := cfg.sourceMaxStaleness("spot"); got != tt.want {
+				t.Errorf("sourceMaxStaleness() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePlatforms(t *testing.T) {
+	tests := []struct {
+		name                string
+		productDescriptions []string
+		wantErr             bool
+	}{
+		{name: "distinct platforms", productDescriptions: []string{"Linux/UNIX", "Windows (Amazon VPC)", "SUSE Linux"}},
+		{name: "duplicate description", productDescriptions: []string{"Linux/UNIX", "Linux/UNIX"}},
+		{name: "both variants", productDescriptions: []string{"Windows", "Linux/UNIX", "Windows (Amazon VPC)"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePlatforms(tt.productDescriptions); (err != nil) != tt.wantErr {
+				t.Errorf("validatePlatforms() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSpotPlacementInstanceTypes(t *testing.T) {
+	enabled := true
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "source disabled", config: Config{}},
+		{name: "instance types", config: Config{SpotPlacementCapacities: []int32{1}, SpotPlacementInstanceTypes: []string{"m5.large", "u-6tb1.metal", "c7i.metal-24xl"}}},
+		{name: "missing instance types", config: Config{SpotPlacementCapacities: []int32{1}}, wantErr: true},
+		{name: "enabled by the source options", config: Config{Sources: map[string]SourceConfig{"spotplacement": {Enabled: &enabled}}}, wantErr: true},
+		{name: "wildcard", config: Config{SpotPlacementCapacities: []int32{1}, SpotPlacementInstanceTypes: []string{"m5.*"}}, wantErr: true},
+		{name: "family", config: Config{SpotPlacementCapacities: []int32{1}, SpotPlacementInstanceTypes: []string{"m5"}}, wantErr: true},
+		{
+			name: "too many instance types",
+			config: Config{SpotPlacementCapacities: []int32{1}, SpotPlacementInstanceTypes: []string{
+				"m5.large", "m5.xlarge", "m5.2xlarge", "m5.4xlarge", "m5.8xlarge", "m5.12xlarge",
+				"m5.16xlarge", "m5.24xlarge", "m5.metal", "m5a.large", "m5a.xlarge",
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validateSpotPlacementInstanceTypes(); (err != nil) != tt.wantErr {
+				t.Errorf("validateSpotPlacementInstanceTypes() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
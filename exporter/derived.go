@@ -0,0 +1,130 @@
+package exporter
+
+// derivedKey identifies a price of an instance type compared by the derived series.
+type derivedKey struct {
+	region           string
+	availabilityZone string
+	instanceType     string
+	platform         string
+	// currency keeps apart the prices of the partitions priced in another currency
+	currency string
+}
+
+// deriveRecords computes the series derived from the prices of a refresh: the spot discount over ondemand per
+// availability zone, the cheapest spot availability zone per region and the cheapest region of every instance type.
+// Prices are matched by platform, ondemand prices are those of shared instances.
+func deriveRecords(records []PriceRecord) []PriceRecord {
+	prices := map[string]map[derivedKey]float64{
+		"spot":     {},
+		"ondemand": {},
+	}
+	for _, record := range records {
+		if record.Name != "ec2" || !isBasePrice(record) {
+			continue
+		}
+		platform := record.platform()
+		if platform == "" {
+			continue
+		}
+
+		lifecyclePrices, ok := prices[record.InstanceLifecycle]
+		if !ok {
+			continue
+		}
+		key := derivedKey{
+			region:           record.Region,
+			availabilityZone: record.AvailabilityZone,
+			instanceType:     record.InstanceType,
+			platform:         platform,
+			currency:         record.currency(),
+		}
+		if price, ok := lifecyclePrices[key]; !ok || record.Value < price {
+			lifecyclePrices[key] = record.Value
+		}
+	}
+
+	derived := make([]PriceRecord, 0)
+	for key, spotPrice := range prices["spot"] {
+		ondemandPrice, ok := prices["ondemand"][key]
+		if !ok {
+			// ondemand prices of the offer files are per region
+			ondemandPrice, ok = prices["ondemand"][derivedKey{region: key.region, instanceType: key.instanceType, platform: key.platform, currency: key.currency}]
+		}
+		if !ok || ondemandPrice == 0 {
+			continue
+		}
+		derived = append(derived, key.record("ec2_spot_discount_ratio", "spot", 1-spotPrice/ondemandPrice))
+	}
+
+	// ondemand prices are the same in all the availability zones of a region, only spot prices differ between them
+	zones := cheapest(prices["spot"], func(key derivedKey) (derivedKey, bool) {
+		group := key
+		group.availabilityZone = ""
+		return group, key.availabilityZone != ""
+	})
+	for _, key := range zones {
+		derived = append(derived, key.record("ec2_cheapest_availability_zone", "spot", prices["spot"][key]))
+	}
+
+	for lifecycle, lifecyclePrices := range prices {
+		regions := cheapest(lifecyclePrices, func(key derivedKey) (derivedKey, bool) {
+			return derivedKey{instanceType: key.instanceType, platform: key.platform, currency: key.currency}, true
+		})
+		for _, key := range regions {
+			derived = append(derived, key.record("ec2_cheapest_region", lifecycle, lifecyclePrices[key]))
+		}
+	}
+
+	return derived
+}
+
+// isBasePrice tells whether the record is a plain spot or ondemand price, the one the derived series compare.
+func isBasePrice(record PriceRecord) bool {
+	switch record.InstanceLifecycle {
+	case "spot":
+		return true
+	case "ondemand":
+		return record.SavingPlanType == "" &&
+			(record.Tenancy == "" || record.Tenancy == "Shared") &&
+			(record.CapacityStatus == "" || record.CapacityStatus == "Used")
+	}
+	return false
+}
+
+// cheapest returns the key of the lowest price of every group of keys, keys outside of any group are skipped.
+// Ties go to the first availability zone or region by name, so the result is stable across refreshes.
+func cheapest(prices map[derivedKey]float64, group func(derivedKey) (derivedKey, bool)) map[derivedKey]derivedKey {
+	result := make(map[derivedKey]derivedKey)
+	for key, price := range prices {
+		g, ok := group(key)
+		if !ok {
+			continue
+		}
+
+		current, ok := result[g]
+		if !ok || price < prices[current] || (price == prices[current] && key.less(current)) {
+			result[g] = key
+		}
+	}
+	return result
+}
+
+func (k derivedKey) less(other derivedKey) bool {
+	if k.region != other.region {
+		return k.region < other.region
+	}
+	return k.availabilityZone < other.availabilityZone
+}
+
+func (k derivedKey) record(name, lifecycle string, value float64) PriceRecord {
+	return PriceRecord{
+		Name:              name,
+		Value:             value,
+		Region:            k.region,
+		AvailabilityZone:  k.availabilityZone,
+		InstanceType:      k.instanceType,
+		InstanceLifecycle: lifecycle,
+		Platform:          k.platform,
+		Currency:          k.currency,
+	}
+}
@@ -0,0 +1,202 @@
+package exporter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func spotRecord(region, az, instanceType string, value float64) PriceRecord {
+	return PriceRecord{
+		Name:               "ec2",
+		Value:              value,
+		Region:             region,
+		AvailabilityZone:   az,
+		InstanceType:       instanceType,
+		InstanceLifecycle:  "spot",
+		Tenancy:            "Shared",
+		ProductDescription: "Linux/UNIX",
+	}
+}
+
+// recordStrings formats the records for comparison, sorted.
+func recordStrings(records []PriceRecord) []string {
+	lines := make([]string, 0, len(records))
+	for _, r := range records {
+		lines = append(lines, fmt.Sprintf("%s %s %s/%s %s %s %.4f", r.Name, r.InstanceLifecycle, r.Region, r.AvailabilityZone, r.InstanceType, r.Platform, r.Value))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestDeriveRecords(t *testing.T) {
+	ondemand := func(region, az, instanceType string, value float64) PriceRecord {
+		record := ondemandRecord(region, instanceType, value)
+		record.AvailabilityZone = az
+		return record
+	}
+
+	tests := []struct {
+		name    string
+		records []PriceRecord
+		want    []string
+	}{
+		{
+			name: "spot discount and cheapest zone and region",
+			records: []PriceRecord{
+				spotRecord("eu-west-1", "eu-west-1a", "c5.large", 0.04),
+				spotRecord("eu-west-1", "eu-west-1b", "c5.large", 0.03),
+				spotRecord("us-east-1", "us-east-1a", "c5.large", 0.035),
+				ondemand("eu-west-1", "eu-west-1a", "c5.large", 0.1),
+				ondemand("eu-west-1", "eu-west-1b", "c5.large", 0.1),
+				ondemand("us-east-1", "us-east-1a", "c5.large", 0.085),
+			},
+			want: []string{
+				"ec2_cheapest_availability_zone spot eu-west-1/eu-west-1b c5.large linux 0.0300",
+				"ec2_cheapest_availability_zone spot us-east-1/us-east-1a c5.large linux 0.0350",
+				"ec2_cheapest_region ondemand us-east-1/us-east-1a c5.large linux 0.0850",
+				"ec2_cheapest_region spot eu-west-1/eu-west-1b c5.large linux 0.0300",
+				"ec2_spot_discount_ratio spot eu-west-1/eu-west-1a c5.large linux 0.6000",
+				"ec2_spot_discount_ratio spot eu-west-1/eu-west-1b c5.large linux 0.7000",
+				"ec2_spot_discount_ratio spot us-east-1/us-east-1a c5.large linux 0.5882",
+			},
+		},
+		{
+			name: "ondemand prices per region",
+			records: []PriceRecord{
+				spotRecord("eu-west-1", "eu-west-1a", "c5.large", 0.04),
+				ondemand("eu-west-1", "", "c5.large", 0.1),
+			},
+			want: []string{
+				"ec2_cheapest_availability_zone spot eu-west-1/eu-west-1a c5.large linux 0.0400",
+				"ec2_cheapest_region ondemand eu-west-1/ c5.large linux 0.1000",
+				"ec2_cheapest_region spot eu-west-1/eu-west-1a c5.large linux 0.0400",
+				"ec2_spot_discount_ratio spot eu-west-1/eu-west-1a c5.large linux 0.6000",
+			},
+		},
+		{
+			name: "other prices are not compared",
+			records: []PriceRecord{
+				spotRecord("eu-west-1", "eu-west-1a", "c5.large", 0.04),
+				func() PriceRecord {
+					r := ondemand("eu-west-1", "eu-west-1a", "c5.large", 0.5)
+					r.Tenancy = "Dedicated"
+					return r
+				}(),
+				func() PriceRecord {
+					r := ondemand("eu-west-1", "eu-west-1a", "c5.large", 0.05)
+					r.SavingPlanType = "Compute"
+					return r
+				}(),
+				func() PriceRecord {
+					r := spotRecord("eu-west-1", "eu-west-1a", "c5.large", 0.01)
+					r.Name = "ec2_spot_price_min"
+					return r
+				}(),
+			},
+			want: []string{
+				"ec2_cheapest_availability_zone spot eu-west-1/eu-west-1a c5.large linux 0.0400",
+				"ec2_cheapest_region spot eu-west-1/eu-west-1a c5.large linux 0.0400",
+			},
+		},
+		{
+			name: "platforms are compared apart",
+			records: []PriceRecord{
+				spotRecord("eu-west-1", "eu-west-1a", "c5.large", 0.04),
+				func() PriceRecord {
+					r := spotRecord("eu-west-1", "eu-west-1b", "c5.large", 0.02)
+					r.ProductDescription = "Windows"
+					return r
+				}(),
+			},
+			want: []string{
+				"ec2_cheapest_availability_zone spot eu-west-1/eu-west-1a c5.large linux 0.0400",
+				"ec2_cheapest_availability_zone spot eu-west-1/eu-west-1b c5.large windows 0.0200",
+				"ec2_cheapest_region spot eu-west-1/eu-west-1a c5.large linux 0.0400",
+				"ec2_cheapest_region spot eu-west-1/eu-west-1b c5.large windows 0.0200",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recordStrings(deriveRecords(tt.records))
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("deriveRecords() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestCheapest(t *testing.T) {
+	byRegion := func(key derivedKey) (derivedKey, bool) {
+		group := key
+		group.availabilityZone = ""
+		return group, key.availabilityZone != ""
+	}
+	byInstanceType := func(key derivedKey) (derivedKey, bool) {
+		return derivedKey{instanceType: key.instanceType}, true
+	}
+
+	tests := []struct {
+		name   string
+		prices map[derivedKey]float64
+		group  func(derivedKey) (derivedKey, bool)
+		want   []string
+	}{
+		{
+			name: "lowest price",
+			prices: map[derivedKey]float64{
+				{region: "eu-west-1", availabilityZone: "eu-west-1a", instanceType: "c5.large"}: 0.04,
+				{region: "eu-west-1", availabilityZone: "eu-west-1b", instanceType: "c5.large"}: 0.03,
+				{region: "eu-west-1", availabilityZone: "eu-west-1c", instanceType: "c5.large"}: 0.05,
+			},
+			group: byRegion,
+			want:  []string{"eu-west-1/eu-west-1b"},
+		},
+		{
+			name: "tie goes to the first zone",
+			prices: map[derivedKey]float64{
+				{region: "eu-west-1", availabilityZone: "eu-west-1c", instanceType: "c5.large"}: 0.03,
+				{region: "eu-west-1", availabilityZone: "eu-west-1a", instanceType: "c5.large"}: 0.03,
+				{region: "eu-west-1", availabilityZone: "eu-west-1b", instanceType: "c5.large"}: 0.03,
+			},
+			group: byRegion,
+			want:  []string{"eu-west-1/eu-west-1a"},
+		},
+		{
+			name: "tie goes to the first region",
+			prices: map[derivedKey]float64{
+				{region: "us-east-1", availabilityZone: "us-east-1a", instanceType: "c5.large"}: 0.03,
+				{region: "eu-west-1", availabilityZone: "eu-west-1b", instanceType: "c5.large"}: 0.03,
+				{region: "eu-west-1", availabilityZone: "eu-west-1a", instanceType: "c5.large"}: 0.04,
+			},
+			group: byInstanceType,
+			want:  []string{"eu-west-1/eu-west-1b"},
+		},
+		{
+			name: "keys outside of any group are skipped",
+			prices: map[derivedKey]float64{
+				{region: "eu-west-1", instanceType: "c5.large"}:                                 0.01,
+				{region: "eu-west-1", availabilityZone: "eu-west-1a", instanceType: "c5.large"}: 0.04,
+			},
+			group: byRegion,
+			want:  []string{"eu-west-1/eu-west-1a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the prices are maps, run a few times to catch an order dependency
+			for i := 0; i < 10; i++ {
+				got := make([]string, 0)
+				for _, key := range cheapest(tt.prices, tt.group) {
+					got = append(got, key.region+"/"+key.availabilityZone)
+				}
+				sort.Strings(got)
+				if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+					t.Fatalf("cheapest() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
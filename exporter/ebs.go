@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	productFamilyStorage    = "Storage"
+	productFamilyOperation  = "System Operation"
+	productFamilyThroughput = "Provisioned Throughput"
+)
+
+// ebsSource exports the monthly prices of the EBS volumes: storage per GB, provisioned IOPS and gp3 throughput.
+type ebsSource struct {
+	*productsFetcher
+	volumeTypes []string
+}
+
+func init() {
+	RegisterPriceSource("ebs", newEBSSource)
+}
+
+func newEBSSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("ebs", len(cfg.EBSVolumeTypes) != 0) {
+		return nil
+	}
+
+	volumeTypes := cfg.EBSVolumeTypes
+	if len(volumeTypes) == 0 {
+		volumeTypes = validEBSVolumeTypes
+	}
+
+	return &ebsSource{
+		productsFetcher: newProductsFetcher(cfg),
+		volumeTypes:     volumeTypes,
+	}
+}
+
+func (s *ebsSource) Name() string {
+	return "ebs"
+}
+
+// FetchRegion returns the EBS prices of the configured volume types in the region. EBS is priced per region, so the
+// prices carry no availability zone.
+func (s *ebsSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	outs, err := s.fetchProducts(ctx, region, [][]priceFilter{
+		{{field: "productFamily", value: productFamilyStorage}},
+		{{field: "productFamily", value: productFamilyOperation}},
+		{{field: "productFamily", value: productFamilyThroughput}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]PriceRecord, 0)
+	for _, out := range outs {
+		volumeType := out.Product.Attributes["volumeApiName"]
+		if !contains(s.volumeTypes, volumeType) {
+			continue
+		}
+
+		var name string
+		switch out.Product.ProductFamily {
+		case productFamilyStorage:
+			name = "ebs_volume_gb_month"
+		case productFamilyOperation:
+			// the operations also hold the I/O requests of the standard volumes, priced per million requests
+			if !strings.HasPrefix(out.Product.Attributes["group"], "EBS IOPS") {
+				continue
+			}
+			name = "ebs_iops_month"
+		case productFamilyThroughput:
+			name = "ebs_throughput_mibps_month"
+		default:
+			continue
+		}
+
+		value, currency, err := chargedPrice(out)
+		if err != nil {
+			log.WithError(err).Errorf("error while parsing ebs price value from API response [region=%s, type=%s]", region, volumeType)
+			continue
+		}
+		log.Debugf("Creating new metric: %s{region=%s, volume_type=%s} = %v.", name, region, volumeType, value)
+
+		records = append(records, PriceRecord{
+			Name:       name,
+			Value:      value,
+			Currency:   currency,
+			Region:     region,
+			VolumeType: volumeType,
+			Tier:       ebsTier(out.Product.Attributes["usagetype"]),
+		})
+	}
+
+	return records, nil
+}
+
+// ebsTier returns the pricing tier of the usage type, the io2 IOPS get cheaper above 32000 (e.g. EBS:VolumeP-IOPS.io2.tier2).
+func ebsTier(usageType string) string {
+	if _, tier, ok := strings.Cut(usageType, ".tier"); ok {
+		return tier
+	}
+	return "1"
+}
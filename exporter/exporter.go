@@ -2,14 +2,16 @@ package exporter
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"regexp"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
@@ -20,53 +22,51 @@ const (
 
 // Exporter implements the prometheus.Exporter interface, and exports AWS Spot Price metrics.
 type Exporter struct {
-	productDescriptions []string
-	operatingSystems    []string
-	regions             []string
-	lifecycle           []string
-	duration            prometheus.Gauge
-	scrapeErrors        prometheus.Gauge
-	totalScrapes        prometheus.Counter
-	pricingMetrics      map[string]*prometheus.GaugeVec
-	instances           map[string]Instance
-	instanceRegexes     []*regexp.Regexp
-	savingPlanTypes     []string
-	awsCfg              aws.Config
-	cache               int
-	nextScrape          time.Time
-	errorCount          uint64
-	metricsMtx          sync.RWMutex
+	config         Config
+	sources        []PriceSource
+	duration       prometheus.Gauge
+	scrapeErrors   prometheus.Gauge
+	totalScrapes   prometheus.Counter
+	pricingMetrics map[string]*prometheus.GaugeVec
+	snapshots      *snapshotStore
+	snapshotAge    *prometheus.Desc
+	// snapshotFileAge is the age of the snapshot file last written or loaded at startup
+	snapshotFileAge   *prometheus.Desc
+	snapshotWrittenAt time.Time
+	instanceTypeInfo  *prometheus.Desc
+	sourceMetrics     *sourceMetrics
+	instances         *instanceCatalog
+	ready             bool
+	reload            chan struct{}
 	sync.RWMutex
 }
 
-type scrapeResult struct {
-	Name               string
-	Value              float64
-	Region             string
-	AvailabilityZone   string
-	InstanceType       string
-	InstanceLifecycle  string
-	ProductDescription string
-	OperatingSystem    string
-	SavingPlanOption   string
-	SavingPlanDuration int
-	SavingPlanType     string
-	Memory             string
-	VCpu               string
-}
-
 // NewExporter returns a new exporter of AWS EC2 Price metrics.
-func NewExporter(pds []string, oss []string, regions []string, lifecycle []string, cache int, instanceRegexes []*regexp.Regexp, savingPlanTypes []string) (*Exporter, error) {
+func NewExporter(ctx context.Context, config Config) (*Exporter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	e := Exporter{
-		productDescriptions: pds,
-		operatingSystems:    oss,
-		regions:             regions,
-		lifecycle:           lifecycle,
-		cache:               cache,
-		instanceRegexes:     instanceRegexes,
-		savingPlanTypes:     savingPlanTypes,
-		nextScrape:          time.Now(),
+		reload:        make(chan struct{}, 1),
+		snapshots:     newSnapshotStore(),
+		sourceMetrics: newSourceMetrics(),
+		instances:     newInstanceCatalog(),
+		snapshotAge: prometheus.NewDesc(
+			prometheus.BuildFQName("aws_pricing", "", "snapshot_age_seconds"),
+			"Seconds since the prices of the source were last fetched successfully in the region.",
+			[]string{"source", "region"}, nil,
+		),
+		snapshotFileAge: prometheus.NewDesc(
+			prometheus.BuildFQName("aws_pricing", "", "snapshot_file_age_seconds"),
+			"Seconds since the snapshot file was written, either by the last refresh or before the start when it was loaded.",
+			nil, nil,
+		),
+		instanceTypeInfo: prometheus.NewDesc(
+			prometheus.BuildFQName("aws_ec2", "", "instance_type_info"),
+			"Hardware of the instance type, from the DescribeInstanceTypes catalog. Always 1.",
+			instanceTypeInfoLabels, nil,
+		),
 		duration: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: "aws_pricing",
 			Name:      "scrape_duration_seconds",
@@ -80,42 +80,115 @@ func NewExporter(pds []string, oss []string, regions []string, lifecycle []strin
 		scrapeErrors: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: "aws_pricing",
 			Name:      "scrape_error",
-			Help:      "The scrape error status.",
+			Help:      "Number of source and region fetches that failed during the last refresh.",
 		}),
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"))
+	e.pricingMetrics = newPricingMetrics(config.LegacyLabels)
+	if err := e.setConfig(ctx, config); err != nil {
+		return nil, err
+	}
+
+	if config.SnapshotFile != "" {
+		e.loadSnapshotFile(config)
+	}
+
+	return &e, nil
+}
+
+// ApplyConfig validates the configuration and swaps it with the running one, then triggers a refresh.
+// Prices of sources and regions that are still configured are kept.
+func (e *Exporter) ApplyConfig(ctx context.Context, config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if err := e.setConfig(ctx, config); err != nil {
+		return err
+	}
+
+	config, sources := e.current()
+	dropped := e.snapshots.prune(func(key snapshotKey, _ regionSnapshot) bool {
+		return !isConfigured(config, sources, key)
+	})
+	for _, key := range dropped {
+		log.Infof("dropping prices no longer configured [source=%s, region=%s]", key.Source, key.Region)
+	}
+
+	select {
+	case e.reload <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// setConfig resolves the regions of the configuration (from the offer files in offline mode) and builds its sources, then swaps both with the running ones.
+func (e *Exporter) setConfig(ctx context.Context, config Config) error {
+	awsConfigs, err := loadAWSConfigs(ctx, config.PartitionProfiles)
 	if err != nil {
-		log.WithError(err).Errorf("error while initializing aws config [region=%s]", "us-east-1")
+		return err
 	}
+	config.awsConfigs = awsConfigs
 
-	e.awsCfg = cfg
+	if len(config.Regions) == 0 && config.OfferFiles != "" {
+		regions, err := newOfferFiles(config.OfferFiles, config.OfferFilesFormat).regions(ctx)
+		if err != nil {
+			return fmt.Errorf("error while listing regions of the offer files: %w", err)
+		}
+		config.Regions = regions
+	} else if len(config.Regions) == 0 {
+		regions, err := describeRegions(ctx, config.awsConfig(partitionRegions[PartitionAWS]))
+		if err != nil {
+			return fmt.Errorf("error while listing available regions: %w", err)
+		}
+		config.Regions = regions
+	}
 
-	e.initGauges()
-	e.getInstances()
+	sources := newPriceSources(config)
 
-	return &e, nil
+	e.Lock()
+	defer e.Unlock()
+
+	e.config = config
+	e.sources = sources
+
+	return nil
 }
 
-func (e *Exporter) initGauges() {
-	e.pricingMetrics = map[string]*prometheus.GaugeVec{}
-	e.pricingMetrics["ec2"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "aws_pricing",
-		Name:      "ec2",
-		Help:      "Current price of the instance type.",
-	}, []string{"instance_lifecycle", "instance_type", "region", "availability_zone", "product_description", "operating_system", "saving_plan_option", "saving_plan_duration", "saving_plan_type", "memory", "vcpu"})
-
-	e.pricingMetrics["ec2_memory"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "aws_pricing",
-		Name:      "ec2_memory",
-		Help:      "Price of each GB of memory of the instance.",
-	}, []string{"instance_lifecycle", "instance_type", "region", "availability_zone", "saving_plan_option", "saving_plan_duration", "saving_plan_type"})
-
-	e.pricingMetrics["ec2_vcpu"] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "aws_pricing",
-		Name:      "ec2_vcpu",
-		Help:      "Price of each VCPU of the instance.",
-	}, []string{"instance_lifecycle", "instance_type", "region", "availability_zone", "saving_plan_option", "saving_plan_duration", "saving_plan_type"})
+// current returns the running configuration and its sources.
+func (e *Exporter) current() (Config, []PriceSource) {
+	e.RLock()
+	defer e.RUnlock()
+
+	return e.config, e.sources
+}
+
+// isConfigured tells whether the source of the snapshot is enabled in its region by the configuration.
+func isConfigured(config Config, sources []PriceSource, key snapshotKey) bool {
+	if !contains(config.Regions, key.Region) || !config.sourceInRegion(key.Source, key.Region) {
+		return false
+	}
+	for _, source := range sources {
+		if source.Name() == key.Source {
+			return true
+		}
+	}
+	return false
+}
+
+func describeRegions(ctx context.Context, cfg aws.Config) ([]string, error) {
+	ec2Svc := ec2.NewFromConfig(cfg)
+	r, err := ec2Svc.DescribeRegions(ctx, &ec2.DescribeRegionsInput{AllRegions: aws.Bool(false)})
+	if err != nil {
+		return nil, err
+	}
+
+	regions := make([]string, 0, len(r.Regions))
+	for _, region := range r.Regions {
+		regions = append(regions, aws.ToString(region.RegionName))
+	}
+
+	return regions, nil
 }
 
 // Describe outputs metric descriptions.
@@ -126,144 +199,223 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.duration.Desc()
 	ch <- e.totalScrapes.Desc()
 	ch <- e.scrapeErrors.Desc()
+	ch <- e.snapshotAge
+	ch <- e.snapshotFileAge
+	ch <- e.instanceTypeInfo
+	e.sourceMetrics.Describe(ch)
 }
 
-// Collect fetches info from the AWS API
+// Collect serves the price snapshot built by the last finished refresh.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.RLock()
+	defer e.RUnlock()
+
+	e.duration.Collect(ch)
+	e.totalScrapes.Collect(ch)
+	e.scrapeErrors.Collect(ch)
+	e.sourceMetrics.Collect(ch)
 
 	now := time.Now()
+	for key, updatedAt := range e.snapshots.updated() {
+		ch <- prometheus.MustNewConstMetric(e.snapshotAge, prometheus.GaugeValue, now.Sub(updatedAt).Seconds(), key.Source, key.Region)
+	}
+	if !e.snapshotWrittenAt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(e.snapshotFileAge, prometheus.GaugeValue, now.Sub(e.snapshotWrittenAt).Seconds())
+	}
+	e.collectInstanceTypeInfo(ch)
+
+	for _, m := range e.pricingMetrics {
+		m.Collect(ch)
+	}
+}
 
-	if now.After(e.nextScrape) {
-		pricingScrapes := make(chan scrapeResult)
+// Ready reports whether the first refresh has finished and prices can be served.
+func (e *Exporter) Ready() bool {
+	e.RLock()
+	defer e.RUnlock()
 
-		e.Lock()
-		defer e.Unlock()
+	return e.ready
+}
 
-		e.initGauges()
-		go e.scrape(pricingScrapes)
-		e.setPricingMetrics(pricingScrapes)
+// Run refreshes the prices in the background every refresh interval until the context is cancelled.
+// Applying a new configuration triggers an immediate refresh.
+func (e *Exporter) Run(ctx context.Context) {
+	for {
+		e.refresh(ctx)
 
-		e.nextScrape = time.Now().Add(time.Second * time.Duration(e.cache))
+		config, _ := e.current()
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.reload:
+		case <-time.After(config.RefreshInterval):
+		}
 	}
+}
 
-	e.duration.Collect(ch)
-	e.totalScrapes.Collect(ch)
-	e.scrapeErrors.Collect(ch)
+// refresh fetches the prices from AWS into the snapshot store, rebuilds the served gauges and, when any fetch
+// succeeded, writes the snapshot file.
+func (e *Exporter) refresh(ctx context.Context) {
+	log.Debug("refreshing prices")
+	config, sources := e.current()
+	succeeded := e.scrape(ctx, config, sources)
 
-	for _, m := range e.pricingMetrics {
-		m.Collect(ch)
+	e.publish(config)
+
+	if config.SnapshotFile != "" && succeeded > 0 {
+		now := time.Now()
+		if err := e.snapshots.save(config.SnapshotFile, now); err != nil {
+			log.WithError(err).Errorf("error while writing snapshot file %s", config.SnapshotFile)
+			return
+		}
+		e.setSnapshotWrittenAt(now)
 	}
 }
 
-func (e *Exporter) scrape(scrapes chan<- scrapeResult) {
-
-	defer close(scrapes)
+// publish drops the snapshots older than the max staleness, rebuilds the gauges from the remaining ones, along with the
+// normalized and derived series, and swaps them with the served ones.
+func (e *Exporter) publish(config Config) {
 	now := time.Now()
+	dropped := e.snapshots.prune(func(key snapshotKey, snapshot regionSnapshot) bool {
+		maxStaleness := config.sourceMaxStaleness(key.Source)
+		return maxStaleness > 0 && now.Sub(snapshot.UpdatedAt) > maxStaleness
+	})
+	for _, key := range dropped {
+		log.Warnf("dropping stale prices [source=%s, region=%s, max-staleness=%s]", key.Source, key.Region, config.sourceMaxStaleness(key.Source))
+	}
 
-	e.totalScrapes.Inc()
+	records := e.snapshots.records()
+	records = append(records, normalizeRecords(config, records, e.getInstance)...)
+	records = append(records, deriveRecords(records)...)
 
-	var errorCount uint64
-	log.Debugf("before for %v\n", e.regions)
+	pricingMetrics := newPricingMetrics(config.LegacyLabels)
+	count := e.setPricingMetrics(pricingMetrics, records, config.LegacyLabels)
 
-	var wg sync.WaitGroup
-	for _, region := range e.regions {
-		if !e.inRegions(region) {
-			log.Debugf("Skipping region %s", region)
-			continue
-		}
+	e.Lock()
+	defer e.Unlock()
 
-		log.Debugf("querying ec2 prices [region=%s]", region)
-		wg.Add(1)
-		go func(region string) {
-			defer wg.Done()
+	e.pricingMetrics = pricingMetrics
+	e.ready = true
+	log.Debugf("prices published [prices=%d]", count)
+}
 
-			cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
-			if err != nil {
-				log.WithError(err).Errorf("error while initializing aws config [region=%s]", region)
-				atomic.AddUint64(&errorCount, 1)
-			}
+// loadSnapshotFile serves the prices of the snapshot file until the first refresh replaces them.
+// Prices of sources and regions that are not configured anymore are skipped.
+func (e *Exporter) loadSnapshotFile(config Config) {
+	writtenAt, err := e.snapshots.load(config.SnapshotFile)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Infof("no snapshot file found, waiting for the first refresh [path=%s]", config.SnapshotFile)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Warnf("error while loading snapshot file, waiting for the first refresh [path=%s]", config.SnapshotFile)
+		return
+	}
 
-			e.awsCfg = cfg
+	_, sources := e.current()
+	e.snapshots.prune(func(key snapshotKey, _ regionSnapshot) bool {
+		return !isConfigured(config, sources, key)
+	})
+	e.setSnapshotWrittenAt(writtenAt)
+	e.publish(config)
+	log.Infof("serving prices from snapshot file [path=%s, written-at=%s]", config.SnapshotFile, writtenAt.Format(time.RFC3339))
+}
 
-			if contains(e.lifecycle, "spot") {
-				e.getSpotPricing(region, scrapes)
-			}
+func (e *Exporter) setSnapshotWrittenAt(writtenAt time.Time) {
+	e.Lock()
+	defer e.Unlock()
 
-			if contains(e.lifecycle, "ondemand") {
-				e.getOnDemandPricing(region, scrapes)
-			}
+	e.snapshotWrittenAt = writtenAt
+}
 
-			if len(e.savingPlanTypes) != 0 {
-				e.getSavingPlanPricing(region, scrapes)
-			}
+// scrape fetches every enabled source in every region concurrently, bounded by the configured concurrency limits.
+// Successful fetches replace the snapshot of their source and region, their number is returned.
+func (e *Exporter) scrape(ctx context.Context, config Config, sources []PriceSource) uint64 {
 
-			return
+	now := time.Now()
+	ctx = withRefresh(ctx, now)
+
+	e.totalScrapes.Inc()
+
+	var errorCount, successCount uint64
+	log.Debugf("querying ec2 prices [regions=%v]", config.Regions)
 
-		}(region)
-		wg.Wait()
+	limits := newLimiter(config.Concurrency, config.ServiceConcurrency)
+	// in offline mode, the instance sizes come from the offer files and the catalog isn't fetched from AWS
+	if config.OfferFiles == "" {
+		e.refreshInstances(ctx, config, limits)
 	}
 
+	var wg sync.WaitGroup
+	for _, region := range config.Regions {
+		// every region gets its own copy of the config, the fetches run concurrently
+		cfg := config.awsConfig(region)
+
+		for _, source := range sources {
+			if !config.sourceInRegion(source.Name(), region) {
+				continue
+			}
+
+			wg.Add(1)
+			go func(source PriceSource, cfg aws.Config, region string) {
+				defer wg.Done()
+
+				if err := limits.acquire(ctx, source.Service()); err != nil {
+					atomic.AddUint64(&errorCount, 1)
+					return
+				}
+				defer limits.release(source.Service())
+
+				log.Debugf("querying ec2 prices [source=%s, region=%s]", source.Name(), region)
+				start := time.Now()
+				records, err := source.FetchRegion(ctx, cfg, region)
+				e.sourceMetrics.observe(source.Name(), region, start, len(records), err)
+				if err != nil {
+					log.WithError(err).Errorf("error while fetching prices, keeping the last good ones [source=%s, region=%s]", source.Name(), region)
+					atomic.AddUint64(&errorCount, 1)
+					return
+				}
+
+				expanded := make([]PriceRecord, 0, len(records))
+				for _, record := range records {
+					expanded = append(expanded, e.expandRecord(record))
+				}
+				e.snapshots.set(snapshotKey{Source: source.Name(), Region: region}, regionSnapshot{
+					UpdatedAt: time.Now(),
+					Records:   expanded,
+				})
+				atomic.AddUint64(&successCount, 1)
+			}(source, cfg, region)
+		}
+	}
+	wg.Wait()
+
 	e.scrapeErrors.Set(float64(atomic.LoadUint64(&errorCount)))
 	e.duration.Set(float64(time.Now().UnixNano()-now.UnixNano()) / 1_000_000_000)
+
+	return atomic.LoadUint64(&successCount)
 }
 
-func (e *Exporter) setPricingMetrics(scrapes <-chan scrapeResult) {
+func (e *Exporter) setPricingMetrics(pricingMetrics map[string]*prometheus.GaugeVec, scrapes []PriceRecord, legacyLabels bool) int {
 	log.Debug("set pricing metrics")
-	for scr := range scrapes {
-		name := scr.Name
-		if _, ok := e.pricingMetrics[name]; !ok {
-			e.metricsMtx.Lock()
-			//defer e.metricsMtx.Unlock()
-			if name == "ec2" {
-				e.pricingMetrics[name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-					Namespace: "aws_pricing",
-					Name:      name,
-				}, []string{"instance_lifecycle", "instance_type", "region", "availability_zone", "product_description", "operating_system", "memory", "vcpu"})
-			} else if name == "ec2_memory" || name == "ec2_vcpu" {
-				e.pricingMetrics[name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-					Namespace: "aws_pricing",
-					Name:      name,
-				}, []string{"instance_lifecycle", "instance_type", "region", "availability_zone"})
-			}
-			e.metricsMtx.Unlock()
-		}
-		var labels prometheus.Labels
-		if name == "ec2" {
-			labels = map[string]string{
-				"instance_lifecycle":   scr.InstanceLifecycle,
-				"instance_type":        scr.InstanceType,
-				"region":               scr.Region,
-				"availability_zone":    scr.AvailabilityZone,
-				"product_description":  scr.ProductDescription,
-				"operating_system":     scr.OperatingSystem,
-				"saving_plan_option":   scr.SavingPlanOption,
-				"saving_plan_duration": strconv.Itoa(scr.SavingPlanDuration),
-				"saving_plan_type":     scr.SavingPlanType,
-				"memory":               scr.Memory,
-				"vcpu":                 scr.VCpu,
-			}
-		} else if name == "ec2_memory" || name == "ec2_vcpu" {
-			labels = map[string]string{
-				"instance_lifecycle":   scr.InstanceLifecycle,
-				"instance_type":        scr.InstanceType,
-				"region":               scr.Region,
-				"availability_zone":    scr.AvailabilityZone,
-				"saving_plan_option":   scr.SavingPlanOption,
-				"saving_plan_duration": strconv.Itoa(scr.SavingPlanDuration),
-				"saving_plan_type":     scr.SavingPlanType,
-			}
+	count := 0
+	for _, scr := range scrapes {
+		def, ok := pricingMetricDefs[scr.Name]
+		if !ok {
+			log.Warnf("skipping price of unknown metric %s", scr.Name)
+			continue
 		}
-		e.pricingMetrics[name].With(labels).Set(float64(scr.Value))
-	}
-}
 
-func (e *Exporter) inRegions(r string) bool {
-	for _, region := range e.regions {
-		if r == region {
-			return true
+		metricLabels := def.metricLabels(legacyLabels)
+		labels := make(prometheus.Labels, len(metricLabels))
+		for _, label := range metricLabels {
+			labels[label] = scr.labelValue(label)
 		}
+		pricingMetrics[scr.Name].With(labels).Set(float64(scr.Value))
+		count++
 	}
-	return false
+
+	return count
 }
 
 func contains(elems []string, v string) bool {
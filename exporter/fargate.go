@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// fargateSource exports the Fargate prices per vCPU-hour and per GB-hour, matching the ec2_vcpu and ec2_memory prices.
+// The Fargate products are part of AmazonECS, they are always read from the Pricing API.
+type fargateSource struct {
+	*productsFetcher
+}
+
+// fargateQueries select the vCPU and memory products of Fargate. Their usage types start with the region prefix (e.g.
+// EUW1-Fargate-GB-Hours), the Pricing API only matches whole terms, so the products are selected by their price unit.
+var fargateQueries = [][]priceFilter{
+	{{field: "productFamily", value: "Compute"}, {field: "cputype", value: "perCPU"}},
+	{{field: "productFamily", value: "Compute"}, {field: "memorytype", value: "perGB"}},
+}
+
+func init() {
+	RegisterPriceSource("fargate", newFargateSource)
+}
+
+func newFargateSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("fargate", cfg.Fargate) {
+		return nil
+	}
+
+	fetcher := newProductsFetcher(cfg)
+	fetcher.serviceCode = "AmazonECS"
+	fetcher.offers = nil
+
+	return &fargateSource{
+		productsFetcher: fetcher,
+	}
+}
+
+func (s *fargateSource) Name() string {
+	return "fargate"
+}
+
+// FetchRegion returns the vCPU and memory prices of Linux x86, Linux ARM and Windows Fargate tasks in the region, and of
+// Fargate Spot, told apart by the usage type of the products (e.g. EUW1-Fargate-ARM-vCPU-Hours:perCPU).
+func (s *fargateSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	outs, err := s.fetchProducts(ctx, region, fargateQueries)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]PriceRecord, 0)
+	for _, out := range outs {
+		usageType := out.Product.Attributes["usagetype"]
+		if !strings.Contains(usageType, "Fargate") {
+			continue
+		}
+
+		var name string
+		switch {
+		case strings.Contains(usageType, "-vCPU-Hours"):
+			name = "fargate_vcpu"
+		case strings.Contains(usageType, "-GB-Hours") && !strings.Contains(usageType, "EphemeralStorage"):
+			name = "fargate_memory"
+		default:
+			// ephemeral storage and the Windows OS license fee
+			continue
+		}
+
+		record := PriceRecord{
+			Name:              name,
+			Region:            region,
+			InstanceLifecycle: "ondemand",
+			OperatingSystem:   "Linux",
+			Architecture:      "x86_64",
+		}
+		if strings.Contains(usageType, "SpotUsage") {
+			record.InstanceLifecycle = "spot"
+		}
+		if strings.Contains(usageType, "-ARM-") {
+			record.Architecture = "arm64"
+		}
+		if strings.Contains(usageType, "-Windows-") {
+			record.OperatingSystem = "Windows"
+		}
+
+		record.Value, record.Currency, err = chargedPrice(out)
+		if err != nil {
+			log.WithError(err).Errorf("error while parsing fargate price value from API response [region=%s, usage-type=%s]", region, usageType)
+			continue
+		}
+		log.Debugf("Creating new metric: %s{region=%s, instance_lifecycle=%s, operating_system=%s, architecture=%s} = %v.", name, region, record.InstanceLifecycle, record.OperatingSystem, record.Architecture, record.Value)
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
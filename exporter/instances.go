@@ -3,63 +3,243 @@ package exporter
 import (
 	"context"
 	"strconv"
-	"sync/atomic"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	// AWS doesn’t share the relationship between CPU and memory for each instance type, therefore we get this info from GCP.
-	// Obviously, it could be some differences between the cpu/memory relationship between the cloud providers but using the GCP
-	// relationship could give us a fairly approximate global idea and allow us know the cost of our pods and namespaces.
+	// instanceTypesSource is the source name of the instance type catalog fetches in the source metrics.
+	instanceTypesSource = "instance-types"
+	// DefaultInstanceTypesRefreshInterval is how often the instance type catalog is fetched again by default, it
+	// changes when new instance types are launched.
+	DefaultInstanceTypesRefreshInterval = 24 * time.Hour
+)
 
-	// To simplify operations and taking into account an approximate global idea would be accepted the CPU-Memory relationship is
-	// calculated as:
+// instanceCatalog holds the instance types of every region, types only offered in some regions are missing from the
+// catalog of the others.
+type instanceCatalog struct {
+	regions map[string]regionCatalog
+	// merged holds the instance types of all the regions
+	merged map[string]Instance
+	sync.RWMutex
+}
 
-	// CPU-cost = 7.2 memory-GB-cost
+type regionCatalog struct {
+	updatedAt time.Time
+	instances map[string]Instance
+}
 
-	// https://engineering.empathy.co/cloud-finops-part-4-kubernetes-cost-report/
-	cpuMemRelation = 7.2
-)
+func newInstanceCatalog() *instanceCatalog {
+	return &instanceCatalog{
+		regions: make(map[string]regionCatalog),
+		merged:  make(map[string]Instance),
+	}
+}
+
+// get returns the instance type from the catalog.
+func (c *instanceCatalog) get(instanceType string) (Instance, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	instance, ok := c.merged[instanceType]
+	return instance, ok
+}
+
+// stale returns the regions whose catalog is missing or older than the refresh interval.
+func (c *instanceCatalog) stale(regions []string, refreshInterval time.Duration, now time.Time) []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	stale := make([]string, 0)
+	for _, region := range regions {
+		catalog, ok := c.regions[region]
+		if !ok || now.Sub(catalog.updatedAt) >= refreshInterval {
+			stale = append(stale, region)
+		}
+	}
+	return stale
+}
+
+// set replaces the catalog of the region and merges it with the ones of the other regions.
+func (c *instanceCatalog) set(region string, instances map[string]Instance, updatedAt time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.regions[region] = regionCatalog{updatedAt: updatedAt, instances: instances}
+
+	merged := make(map[string]Instance, len(c.merged))
+	for _, catalog := range c.regions {
+		for instanceType, instance := range catalog.instances {
+			merged[instanceType] = instance
+		}
+	}
+	c.merged = merged
+}
+
+// refreshInstances fetches the catalog of the regions whose catalog is older than the instance types refresh interval.
+// The catalog of a region whose fetch fails is kept until the next refresh.
+func (e *Exporter) refreshInstances(ctx context.Context, config Config, limits *limiter) {
+	var wg sync.WaitGroup
+	for _, region := range e.instances.stale(config.Regions, config.InstanceTypesRefreshInterval, time.Now()) {
+		cfg := config.awsConfig(region)
+
+		wg.Add(1)
+		go func(cfg aws.Config, region string) {
+			defer wg.Done()
+
+			if err := limits.acquire(ctx, "ec2"); err != nil {
+				return
+			}
+			defer limits.release("ec2")
+
+			start := time.Now()
+			instances, err := getInstances(ctx, cfg)
+			e.sourceMetrics.observe(instanceTypesSource, region, start, len(instances), err)
+			if err != nil {
+				log.WithError(err).Errorf("error while fetching available instance types [region=%s]", region)
+				return
+			}
+			e.instances.set(region, instances, time.Now())
+		}(cfg, region)
+	}
+	wg.Wait()
+}
 
-func (e *Exporter) getInstances() {
-	e.instances = make(map[string]Instance)
-	ec2Svc := ec2.NewFromConfig(e.awsCfg)
+// getInstances returns the instance types offered in the region of the config.
+func getInstances(ctx context.Context, cfg aws.Config) (map[string]Instance, error) {
+	instances := make(map[string]Instance)
 	pag := ec2.NewDescribeInstanceTypesPaginator(
-		ec2Svc,
+		ec2.NewFromConfig(cfg),
 		&ec2.DescribeInstanceTypesInput{})
 	for pag.HasMorePages() {
-		instances, err := pag.NextPage(context.TODO())
+		page, err := pag.NextPage(ctx)
 		if err != nil {
-			log.WithError(err).Errorf("error while fetching available instance types")
-			atomic.AddUint64(&e.errorCount, 1)
-			break
+			return nil, err
 		}
-		for _, instance := range instances.InstanceTypes {
-			e.instances[string(instance.InstanceType)] = Instance{
-				Memory: aws.ToInt64(instance.MemoryInfo.SizeInMiB),
-				VCpu:   aws.ToInt32(instance.VCpuInfo.DefaultVCpus),
-			}
+		for _, instance := range page.InstanceTypes {
+			instances[string(instance.InstanceType)] = newInstance(instance)
+		}
+	}
+
+	return instances, nil
+}
+
+// newInstance returns the hardware of the instance type, attributes missing from the catalog are left empty.
+func newInstance(info ec2types.InstanceTypeInfo) Instance {
+	instance := Instance{
+		Burstable:         aws.ToBool(info.BurstablePerformanceSupported),
+		Hypervisor:        string(info.Hypervisor),
+		CurrentGeneration: aws.ToBool(info.CurrentGeneration),
+	}
+	if info.MemoryInfo != nil {
+		instance.Memory = aws.ToInt64(info.MemoryInfo.SizeInMiB)
+	}
+	if info.VCpuInfo != nil {
+		instance.VCpu = aws.ToInt32(info.VCpuInfo.DefaultVCpus)
+	}
+	if info.ProcessorInfo != nil {
+		architectures := make([]string, 0, len(info.ProcessorInfo.SupportedArchitectures))
+		for _, architecture := range info.ProcessorInfo.SupportedArchitectures {
+			architectures = append(architectures, string(architecture))
+		}
+		instance.Architecture = strings.Join(architectures, ",")
+	}
+	if info.GpuInfo != nil {
+		models := make([]string, 0, len(info.GpuInfo.Gpus))
+		for _, gpu := range info.GpuInfo.Gpus {
+			instance.GPUs += aws.ToInt32(gpu.Count)
+			models = append(models, strings.TrimSpace(aws.ToString(gpu.Manufacturer)+" "+aws.ToString(gpu.Name)))
 		}
+		instance.GPUModel = strings.Join(models, ",")
+		instance.GPUMemory = aws.ToInt32(info.GpuInfo.TotalGpuMemoryInMiB)
+	}
+	if info.NetworkInfo != nil {
+		instance.NetworkPerformance = aws.ToString(info.NetworkInfo.NetworkPerformance)
+	}
+	if info.EbsInfo != nil && info.EbsInfo.EbsOptimizedInfo != nil {
+		instance.EBSBandwidth = aws.ToInt32(info.EbsInfo.EbsOptimizedInfo.BaselineBandwidthInMbps)
+	}
+	if info.InstanceStorageInfo != nil {
+		instance.InstanceStorage = aws.ToInt64(info.InstanceStorageInfo.TotalSizeInGB)
+	}
+	virtualizations := make([]string, 0, len(info.SupportedVirtualizationTypes))
+	for _, virtualization := range info.SupportedVirtualizationTypes {
+		virtualizations = append(virtualizations, string(virtualization))
+	}
+	instance.Virtualization = strings.Join(virtualizations, ",")
+
+	return instance
+}
+
+// instanceTypeInfoLabels are the labels of the aws_ec2_instance_type_info metric, in the order of infoLabelValues.
+var instanceTypeInfoLabels = []string{
+	"instance_type", "architecture", "gpu_count", "gpu_model", "gpu_memory_mib", "network_performance",
+	"ebs_bandwidth_mbps", "instance_storage_gb", "burstable", "hypervisor", "current_generation", "virtualization",
+}
+
+// infoLabelValues returns the values of the instanceTypeInfoLabels of the instance type.
+func (i Instance) infoLabelValues(instanceType string) []string {
+	return []string{
+		instanceType,
+		i.Architecture,
+		strconv.Itoa(int(i.GPUs)),
+		i.GPUModel,
+		strconv.Itoa(int(i.GPUMemory)),
+		i.NetworkPerformance,
+		strconv.Itoa(int(i.EBSBandwidth)),
+		strconv.FormatInt(i.InstanceStorage, 10),
+		strconv.FormatBool(i.Burstable),
+		i.Hypervisor,
+		strconv.FormatBool(i.CurrentGeneration),
+		i.Virtualization,
 	}
 }
 
-func (e *Exporter) getInstanceMemory(instance string) string {
-	return strconv.Itoa(int(e.instances[instance].Memory))
+// collectInstanceTypeInfo sends an info metric of every instance type of the catalog matching the instance regexes.
+func (e *Exporter) collectInstanceTypeInfo(ch chan<- prometheus.Metric) {
+	e.instances.RLock()
+	defer e.instances.RUnlock()
+
+	for instanceType, instance := range e.instances.merged {
+		if !isMatchAny(e.config.instanceRegexes, instanceType) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(e.instanceTypeInfo, prometheus.GaugeValue, 1, instance.infoLabelValues(instanceType)...)
+	}
 }
 
-func (e *Exporter) getInstanceVCpu(instance string) string {
-	return strconv.Itoa(int(e.instances[instance].VCpu))
+// getInstance returns the size of the instance type of the record from the catalog. Types missing in the catalog fall
+// back to the size reported by the source, if any.
+func (e *Exporter) getInstance(record PriceRecord) Instance {
+	if instance, ok := e.instances.get(record.InstanceType); ok {
+		return instance
+	}
+
+	memory, _ := strconv.ParseInt(record.Memory, 10, 64)
+	vcpu, _ := strconv.ParseInt(record.VCpu, 10, 32)
+	return Instance{
+		Memory: memory,
+		VCpu:   int32(vcpu),
+	}
 }
 
-func (e *Exporter) getNormalizedCost(value float64, instance string) (float64, float64) {
-	vcpu := e.instances[instance].VCpu
-	memory := e.instances[instance].Memory / 1024
+// expandRecord fills the instance size labels of an ec2 price record, the normalized prices are computed when the
+// prices are published.
+func (e *Exporter) expandRecord(record PriceRecord) PriceRecord {
+	if record.Name != "ec2" {
+		return record
+	}
 
-	memoryCost := value / (cpuMemRelation*float64(vcpu) + float64(memory))
-	vcpuCost := cpuMemRelation * memoryCost
+	instance := e.getInstance(record)
+	record.Memory = strconv.Itoa(int(instance.Memory))
+	record.VCpu = strconv.Itoa(int(instance.VCpu))
 
-	return vcpuCost, memoryCost
+	return record
 }
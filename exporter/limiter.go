@@ -0,0 +1,53 @@
+package exporter
+
+import "context"
+
+// limiter bounds the number of concurrent fetches, globally and per AWS service.
+type limiter struct {
+	global   chan struct{}
+	services map[string]chan struct{}
+}
+
+// newLimiter returns a limiter allowing global concurrent fetches in total and services[service] fetches per service.
+// Services without a limit are only bound by the global one.
+func newLimiter(global int, services map[string]int) *limiter {
+	l := &limiter{
+		global:   make(chan struct{}, global),
+		services: make(map[string]chan struct{}, len(services)),
+	}
+	for service, limit := range services {
+		l.services[service] = make(chan struct{}, limit)
+	}
+
+	return l
+}
+
+// acquire blocks until a fetch against the service is allowed or the context is done.
+// The service slot is always taken before the global one, so waiting for a throttled service doesn't hold a global slot.
+func (l *limiter) acquire(ctx context.Context, service string) error {
+	if sem, ok := l.services[service]; ok {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case l.global <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		if sem, ok := l.services[service]; ok {
+			<-sem
+		}
+		return ctx.Err()
+	}
+}
+
+// release frees the slots taken by acquire.
+func (l *limiter) release(service string) {
+	<-l.global
+	if sem, ok := l.services[service]; ok {
+		<-sem
+	}
+}
@@ -0,0 +1,237 @@
+package exporter
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pricingMetricDef describes a gauge built from the price records of the same name.
+type pricingMetricDef struct {
+	help   string
+	labels []string
+	// namespace of the metric, aws_pricing when empty
+	namespace string
+}
+
+var (
+	// sizeLabels are the labels telling apart the prices of an instance type, shared by the ec2 metrics.
+	sizeLabels = []string{"instance_lifecycle", "platform", "tenancy", "capacity_status", "instance_type", "region", "availability_zone", "saving_plan_option", "saving_plan_duration", "saving_plan_type", "reserved_option", "reserved_duration", "reserved_offering_class", "currency"}
+
+	// spotHistoryLabels are the labels of the spot price statistics, matching the spot prices of the ec2 metric.
+	spotHistoryLabels = []string{"instance_type", "region", "availability_zone", "platform", "product_description", "currency"}
+
+	pricingMetricDefs = map[string]pricingMetricDef{
+		"ec2": {
+			help:   "Current price of the instance type.",
+			labels: append([]string{"product_description", "operating_system", "pre_installed_software", "license_model", "memory", "vcpu"}, sizeLabels...),
+		},
+		"ec2_memory": {
+			help:   "Price of each GB of memory of the instance.",
+			labels: sizeLabels,
+		},
+		"ec2_vcpu": {
+			help:   "Price of each VCPU of the instance.",
+			labels: sizeLabels,
+		},
+		"ec2_unknown_instance_types": {
+			help:   "Number of instance types priced in the region but missing in the instance type catalog, their vcpu, memory and gpu prices are skipped.",
+			labels: []string{"region"},
+		},
+		"ec2_gpu": {
+			help:   "Price of each GPU of the instance, only exported by the gpu normalization model.",
+			labels: sizeLabels,
+		},
+		"ec2_reserved_upfront": {
+			help:   "Upfront fee of the reserved instance.",
+			labels: []string{"instance_type", "tenancy", "capacity_status", "region", "platform", "operating_system", "pre_installed_software", "license_model", "reserved_option", "reserved_duration", "reserved_offering_class", "currency"},
+		},
+		"ec2_capacity_reservation_idle_instances": {
+			help:   "Number of available instances of the active capacity reservations.",
+			labels: []string{"instance_type", "tenancy", "region", "availability_zone", "platform", "operating_system", "pre_installed_software"},
+		},
+		"ec2_capacity_reservation_idle_cost": {
+			help:   "Hourly cost of the available instances of the active capacity reservations.",
+			labels: []string{"instance_type", "tenancy", "region", "availability_zone", "platform", "operating_system", "pre_installed_software", "currency"},
+		},
+		"ebs_volume_gb_month": {
+			help:   "Monthly price of each GB of storage of the EBS volume type.",
+			labels: []string{"region", "volume_type", "currency"},
+		},
+		"ebs_iops_month": {
+			help:   "Monthly price of each provisioned IOPS of the EBS volume type.",
+			labels: []string{"region", "volume_type", "tier", "currency"},
+		},
+		"ebs_throughput_mibps_month": {
+			help:   "Monthly price of each provisioned MiB/s of throughput of the EBS volume type.",
+			labels: []string{"region", "volume_type", "currency"},
+		},
+		"fargate_vcpu": {
+			help:   "Price of each VCPU of a Fargate task per hour.",
+			labels: []string{"instance_lifecycle", "region", "platform", "operating_system", "architecture", "currency"},
+		},
+		"fargate_memory": {
+			help:   "Price of each GB of memory of a Fargate task per hour.",
+			labels: []string{"instance_lifecycle", "region", "platform", "operating_system", "architecture", "currency"},
+		},
+		"ec2_spot_price_min": {
+			help:   "Lowest spot price of the instance type over the spot history window.",
+			labels: spotHistoryLabels,
+		},
+		"ec2_spot_price_max": {
+			help:   "Highest spot price of the instance type over the spot history window.",
+			labels: spotHistoryLabels,
+		},
+		"ec2_spot_price_mean": {
+			help:   "Mean spot price of the instance type over the spot history window, weighted by how long each price held.",
+			labels: spotHistoryLabels,
+		},
+		"ec2_spot_price_stddev": {
+			help:   "Standard deviation of the spot price of the instance type over the spot history window, weighted by how long each price held.",
+			labels: spotHistoryLabels,
+		},
+		"ec2_spot_price_changes": {
+			help:   "Number of spot price changes of the instance type over the spot history window.",
+			labels: spotHistoryLabels,
+		},
+		"ec2_spot_discount_ratio": {
+			help:   "Discount of the spot price of the instance type over its ondemand price (0-1).",
+			labels: []string{"instance_type", "region", "availability_zone", "platform"},
+		},
+		"ec2_cheapest_availability_zone": {
+			help:   "Lowest spot price of the instance type in the region, the availability_zone label is the zone offering it.",
+			labels: []string{"instance_lifecycle", "instance_type", "region", "availability_zone", "platform", "currency"},
+		},
+		"ec2_cheapest_region": {
+			help:   "Lowest price of the instance type across the regions, the region label is the region offering it.",
+			labels: []string{"instance_lifecycle", "instance_type", "region", "platform", "currency"},
+		},
+		"spot_placement_score": {
+			help:   "Spot placement score (1-10) of the instance types, how likely a Spot request of the target capacity diversified over them succeeds in the region or availability zone.",
+			labels: []string{"instance_type", "region", "availability_zone", "target_capacity"},
+		},
+		"spot_interruption_bucket": {
+			help:   "Interruption frequency bucket (0-4) of the spot instance type, from the Spot Instance Advisor.",
+			labels: []string{"instance_type", "region", "platform", "operating_system", "interruption_frequency"},
+		},
+		"spot_savings_over_ondemand_ratio": {
+			help:   "Savings of the spot instance type over ondemand (0-1), from the Spot Instance Advisor.",
+			labels: []string{"instance_type", "region", "platform", "operating_system"},
+		},
+		"instance_type_offered": {
+			help:      "Whether the instance type is offered (1) or not (0) in the availability zone.",
+			labels:    []string{"instance_type", "region", "availability_zone"},
+			namespace: "aws_ec2",
+		},
+		"availability_zone_info": {
+			help:      "Availability zone of the region, the zone_id is the same physical zone in every account. Always 1.",
+			labels:    []string{"region", "availability_zone", "zone_id", "zone_type", "parent_zone", "zone_group"},
+			namespace: "aws_ec2",
+		},
+		"ec2_dedicated_host": {
+			help:   "Current price of a dedicated host of the instance family.",
+			labels: []string{"instance_lifecycle", "instance_family", "region", "availability_zone", "currency"},
+		},
+	}
+)
+
+// newPricingMetrics builds the gauges of the metric definitions, the legacy labels replaced by the platform label are
+// only kept with legacyLabels.
+func newPricingMetrics(legacyLabels bool) map[string]*prometheus.GaugeVec {
+	pricingMetrics := map[string]*prometheus.GaugeVec{}
+	for name, def := range pricingMetricDefs {
+		namespace := def.namespace
+		if namespace == "" {
+			namespace = "aws_pricing"
+		}
+		pricingMetrics[name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      def.help,
+		}, def.metricLabels(legacyLabels))
+	}
+
+	return pricingMetrics
+}
+
+// metricLabels returns the labels of the metric, without the legacy labels unless legacyLabels is set.
+func (d pricingMetricDef) metricLabels(legacyLabels bool) []string {
+	if legacyLabels {
+		return d.labels
+	}
+
+	labels := make([]string, 0, len(d.labels))
+	for _, label := range d.labels {
+		if !contains(legacyLabelNames, label) {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// labelValue returns the value of the label of the record.
+func (r PriceRecord) labelValue(label string) string {
+	switch label {
+	case "instance_lifecycle":
+		return r.InstanceLifecycle
+	case "instance_type":
+		return r.InstanceType
+	case "instance_family":
+		return r.InstanceFamily
+	case "tenancy":
+		return r.Tenancy
+	case "capacity_status":
+		return r.CapacityStatus
+	case "region":
+		return r.Region
+	case "availability_zone":
+		return r.AvailabilityZone
+	case "product_description":
+		return r.ProductDescription
+	case "operating_system":
+		return r.OperatingSystem
+	case "platform":
+		return r.platform()
+	case "pre_installed_software":
+		return r.PreInstalledSoftware
+	case "license_model":
+		return r.LicenseModel
+	case "saving_plan_option":
+		return r.SavingPlanOption
+	case "saving_plan_duration":
+		return strconv.Itoa(r.SavingPlanDuration)
+	case "saving_plan_type":
+		return r.SavingPlanType
+	case "reserved_option":
+		return r.ReservedOption
+	case "reserved_duration":
+		return strconv.Itoa(r.ReservedDuration)
+	case "reserved_offering_class":
+		return r.ReservedOfferingClass
+	case "architecture":
+		return r.Architecture
+	case "interruption_frequency":
+		return r.InterruptionFrequency
+	case "target_capacity":
+		return strconv.Itoa(r.TargetCapacity)
+	case "volume_type":
+		return r.VolumeType
+	case "tier":
+		return r.Tier
+	case "currency":
+		return r.currency()
+	case "zone_id":
+		return r.ZoneID
+	case "zone_type":
+		return r.ZoneType
+	case "parent_zone":
+		return r.ParentZone
+	case "zone_group":
+		return r.ZoneGroup
+	case "memory":
+		return r.Memory
+	case "vcpu":
+		return r.VCpu
+	}
+	return ""
+}
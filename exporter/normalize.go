@@ -0,0 +1,212 @@
+package exporter
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// NormalizationRatio splits the prices between vcpu and memory with the configured cpu:memory cost ratio.
+	NormalizationRatio = "ratio"
+	// NormalizationFitted splits the prices with the cpu:memory cost ratio fitted to the ondemand prices of the region.
+	NormalizationFitted = "fitted"
+	// NormalizationGPU is NormalizationFitted, taking the share of the GPUs out of the prices of the GPU instances first.
+	NormalizationGPU = "gpu"
+
+	// AWS doesn’t share the relationship between CPU and memory for each instance type, therefore we get this info from GCP.
+	// Obviously, it could be some differences between the cpu/memory relationship between the cloud providers but using the GCP
+	// relationship could give us a fairly approximate global idea and allow us know the cost of our pods and namespaces.
+
+	// To simplify operations and taking into account an approximate global idea would be accepted the CPU-Memory relationship is
+	// calculated as:
+
+	// CPU-cost = 7.2 memory-GB-cost
+
+	// https://engineering.empathy.co/cloud-finops-part-4-kubernetes-cost-report/
+	DefaultCPUMemoryRatio = 7.2
+)
+
+var (
+	validNormalizationModels = []string{NormalizationRatio, NormalizationFitted, NormalizationGPU}
+
+	// fittedFamilies are the instance families the regional rates are fitted to: the general purpose, compute and memory
+	// optimized ones, their different memory per vcpu lets the fit tell the vcpu and memory rates apart.
+	fittedFamilies = regexp.MustCompile(`^[cmr][0-9]+[a-z]*$`)
+)
+
+// normalizationRates are the hourly prices of a vcpu and of a GB of memory fitted to the ondemand prices of a region.
+type normalizationRates struct {
+	vcpu   float64
+	memory float64
+}
+
+// gpuKey identifies the GPU share of an instance type in a region.
+type gpuKey struct {
+	region       string
+	instanceType string
+}
+
+// normalizer splits the ec2 prices between the vcpus, the memory and, with the gpu model, the GPUs of the instances.
+type normalizer struct {
+	model    string
+	ratio    float64
+	instance func(PriceRecord) Instance
+	// rates of the regions the fit succeeded in, the others fall back to the configured ratio
+	rates map[string]normalizationRates
+	// gpuShares are the shares of the GPUs in the ondemand prices of the GPU instance types
+	gpuShares map[gpuKey]float64
+}
+
+// normalizeRecords returns the vcpu, memory and gpu prices of the ec2 prices of a refresh. Instance types of unknown
+// size, missing from the instance type catalog, are skipped and counted per region.
+func normalizeRecords(config Config, records []PriceRecord, instance func(PriceRecord) Instance) []PriceRecord {
+	n := newNormalizer(config, records, instance)
+
+	unknown := make(map[string]map[string]bool)
+	normalized := make([]PriceRecord, 0, 2*len(records))
+	for _, record := range records {
+		if record.Name != "ec2" {
+			continue
+		}
+		if _, ok := unknown[record.Region]; !ok {
+			unknown[record.Region] = make(map[string]bool)
+		}
+
+		size := n.instance(record)
+		if size.VCpu <= 0 || size.Memory <= 0 {
+			unknown[record.Region][record.InstanceType] = true
+			continue
+		}
+		normalized = append(normalized, n.normalize(record)...)
+	}
+
+	for region, instanceTypes := range unknown {
+		if len(instanceTypes) > 0 {
+			log.Debugf("skipping normalized prices of instance types missing in the catalog [region=%s, instance-types=%d]", region, len(instanceTypes))
+		}
+		normalized = append(normalized, PriceRecord{
+			Name:   "ec2_unknown_instance_types",
+			Value:  float64(len(instanceTypes)),
+			Region: region,
+		})
+	}
+	return normalized
+}
+
+func newNormalizer(config Config, records []PriceRecord, instance func(PriceRecord) Instance) *normalizer {
+	n := &normalizer{
+		model:     config.NormalizationModel,
+		ratio:     config.CPUMemoryRatio,
+		instance:  instance,
+		rates:     make(map[string]normalizationRates),
+		gpuShares: make(map[gpuKey]float64),
+	}
+	if n.model == NormalizationRatio {
+		return n
+	}
+
+	// the ondemand Linux prices of the regions, the fit is independent of the lifecycle and the platform of the prices
+	prices := make(map[string][]PriceRecord)
+	for _, record := range records {
+		if record.Name == "ec2" && record.InstanceLifecycle == "ondemand" && isBasePrice(record) && record.platform() == "linux" {
+			prices[record.Region] = append(prices[record.Region], record)
+		}
+	}
+
+	for region, regionPrices := range prices {
+		rates, ok := n.fit(regionPrices)
+		if !ok {
+			continue
+		}
+		n.rates[region] = rates
+
+		if n.model != NormalizationGPU {
+			continue
+		}
+		for _, record := range regionPrices {
+			instance := n.instance(record)
+			if instance.GPUs == 0 || record.Value <= 0 {
+				continue
+			}
+			share := 1 - (rates.vcpu*float64(instance.VCpu)+rates.memory*memoryGB(instance))/record.Value
+			n.gpuShares[gpuKey{region: region, instanceType: record.InstanceType}] = math.Max(0, math.Min(1, share))
+		}
+	}
+
+	return n
+}
+
+// fit returns the vcpu and memory rates best fitting the prices of the fitted families (least squares, no intercept).
+func (n *normalizer) fit(records []PriceRecord) (normalizationRates, bool) {
+	var vv, vm, mm, vp, mp float64
+	for _, record := range records {
+		family, _, _ := strings.Cut(record.InstanceType, ".")
+		instance := n.instance(record)
+		if !fittedFamilies.MatchString(family) || instance.GPUs != 0 {
+			continue
+		}
+
+		vcpu, memory := float64(instance.VCpu), memoryGB(instance)
+		vv += vcpu * vcpu
+		vm += vcpu * memory
+		mm += memory * memory
+		vp += vcpu * record.Value
+		mp += memory * record.Value
+	}
+
+	det := vv*mm - vm*vm
+	if det <= 1e-9*vv*mm {
+		// no prices or a single memory per vcpu, the rates can't be told apart
+		return normalizationRates{}, false
+	}
+	rates := normalizationRates{
+		vcpu:   (vp*mm - mp*vm) / det,
+		memory: (mp*vv - vp*vm) / det,
+	}
+	return rates, rates.vcpu > 0 && rates.memory > 0
+}
+
+// normalize returns the vcpu and memory prices of the record, and the price of a GPU when its share is known.
+func (n *normalizer) normalize(record PriceRecord) []PriceRecord {
+	instance := n.instance(record)
+
+	ratio := n.ratio
+	if rates, ok := n.rates[record.Region]; ok {
+		ratio = rates.vcpu / rates.memory
+	}
+
+	normalized := make([]PriceRecord, 0, 3)
+	value := record.Value
+	if share, ok := n.gpuShares[gpuKey{region: record.Region, instanceType: record.InstanceType}]; ok {
+		gpuRecord := record
+		gpuRecord.Name = "ec2_gpu"
+		gpuRecord.Value = value * share / float64(instance.GPUs)
+		normalized = append(normalized, gpuRecord)
+		value -= value * share
+	}
+
+	vcpu, memory := getNormalizedCost(value, instance, ratio)
+	memoryRecord := record
+	memoryRecord.Name = "ec2_memory"
+	memoryRecord.Value = memory
+	vcpuRecord := record
+	vcpuRecord.Name = "ec2_vcpu"
+	vcpuRecord.Value = vcpu
+
+	return append(normalized, memoryRecord, vcpuRecord)
+}
+
+// getNormalizedCost splits the value between the vcpus and the memory of the instance, a vcpu costing ratio GB of memory.
+func getNormalizedCost(value float64, instance Instance, ratio float64) (float64, float64) {
+	memoryCost := value / (ratio*float64(instance.VCpu) + memoryGB(instance))
+	vcpuCost := ratio * memoryCost
+
+	return vcpuCost, memoryCost
+}
+
+func memoryGB(instance Instance) float64 {
+	return float64(instance.Memory) / 1024
+}
@@ -0,0 +1,216 @@
+package exporter
+
+import (
+	"testing"
+)
+
+// testInstances are the sizes of the instance types of the normalization tests.
+var testInstances = map[string]Instance{
+	"c5.large":    {VCpu: 2, Memory: 4 * 1024},
+	"m5.large":    {VCpu: 2, Memory: 8 * 1024},
+	"r5.large":    {VCpu: 2, Memory: 16 * 1024},
+	"m5.xlarge":   {VCpu: 4, Memory: 16 * 1024},
+	"t3.large":    {VCpu: 2, Memory: 8 * 1024},
+	"g4dn.xlarge": {VCpu: 4, Memory: 16 * 1024, GPUs: 1},
+	"p3.8xlarge":  {VCpu: 32, Memory: 244 * 1024, GPUs: 4},
+}
+
+func testInstance(record PriceRecord) Instance {
+	return testInstances[record.InstanceType]
+}
+
+func ondemandRecord(region, instanceType string, value float64) PriceRecord {
+	return PriceRecord{
+		Name:              "ec2",
+		Value:             value,
+		Region:            region,
+		InstanceType:      instanceType,
+		InstanceLifecycle: "ondemand",
+		Tenancy:           "Shared",
+		OperatingSystem:   "Linux",
+	}
+}
+
+// linearPrice is the price of the instance type at 0.03 per vcpu and 0.004 per GB of memory.
+func linearPrice(instanceType string) float64 {
+	instance := testInstances[instanceType]
+	return 0.03*float64(instance.VCpu) + 0.004*memoryGB(instance)
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []PriceRecord
+		want    normalizationRates
+		wantOK  bool
+	}{
+		{
+			name: "exact prices",
+			records: []PriceRecord{
+				ondemandRecord("eu-west-1", "c5.large", linearPrice("c5.large")),
+				ondemandRecord("eu-west-1", "m5.large", linearPrice("m5.large")),
+				ondemandRecord("eu-west-1", "r5.large", linearPrice("r5.large")),
+				ondemandRecord("eu-west-1", "m5.xlarge", linearPrice("m5.xlarge")),
+			},
+			want:   normalizationRates{vcpu: 0.03, memory: 0.004},
+			wantOK: true,
+		},
+		{
+			// least squares of 2v+4m=0.08, 2v+8m=0.09, 2v+16m=0.12: v=0.0325, m=19/5600
+			name: "least squares",
+			records: []PriceRecord{
+				ondemandRecord("eu-west-1", "c5.large", 0.08),
+				ondemandRecord("eu-west-1", "m5.large", 0.09),
+				ondemandRecord("eu-west-1", "r5.large", 0.12),
+			},
+			want:   normalizationRates{vcpu: 0.0325, memory: 19.0 / 5600},
+			wantOK: true,
+		},
+		{
+			name: "unfitted families and GPU instances are ignored",
+			records: []PriceRecord{
+				ondemandRecord("eu-west-1", "c5.large", linearPrice("c5.large")),
+				ondemandRecord("eu-west-1", "r5.large", linearPrice("r5.large")),
+				ondemandRecord("eu-west-1", "t3.large", 1),
+				ondemandRecord("eu-west-1", "g4dn.xlarge", 1),
+			},
+			want:   normalizationRates{vcpu: 0.03, memory: 0.004},
+			wantOK: true,
+		},
+		{
+			name: "single memory per vcpu",
+			records: []PriceRecord{
+				ondemandRecord("eu-west-1", "m5.large", linearPrice("m5.large")),
+				ondemandRecord("eu-west-1", "m5.xlarge", 2*linearPrice("m5.large")),
+			},
+			wantOK: false,
+		},
+		{
+			name: "negative rate",
+			records: []PriceRecord{
+				ondemandRecord("eu-west-1", "c5.large", 0.2),
+				ondemandRecord("eu-west-1", "r5.large", 0.1),
+			},
+			wantOK: false,
+		},
+		{
+			name:   "no prices",
+			wantOK: false,
+		},
+	}
+	n := &normalizer{instance: testInstance}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := n.fit(tt.records)
+			if ok != tt.wantOK {
+				t.Fatalf("fit() ok = %t, want %t (rates %+v)", ok, tt.wantOK, got)
+			}
+			if ok && (!almostEqual(got.vcpu, tt.want.vcpu) || !almostEqual(got.memory, tt.want.memory)) {
+				t.Errorf("fit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGPUShares(t *testing.T) {
+	records := []PriceRecord{
+		ondemandRecord("eu-west-1", "c5.large", linearPrice("c5.large")),
+		ondemandRecord("eu-west-1", "m5.large", linearPrice("m5.large")),
+		ondemandRecord("eu-west-1", "r5.large", linearPrice("r5.large")),
+		// 0.184 of vcpu and memory, the GPU takes the rest
+		ondemandRecord("eu-west-1", "g4dn.xlarge", 0.736),
+		// cheaper than its vcpu and memory, the share is clamped
+		ondemandRecord("eu-west-1", "p3.8xlarge", 1),
+		// no fit in the region, no GPU share
+		ondemandRecord("us-east-1", "g4dn.xlarge", 0.526),
+	}
+
+	tests := []struct {
+		model string
+		want  map[gpuKey]float64
+	}{
+		{
+			model: NormalizationGPU,
+			want: map[gpuKey]float64{
+				{region: "eu-west-1", instanceType: "g4dn.xlarge"}: 0.75,
+				{region: "eu-west-1", instanceType: "p3.8xlarge"}:  0,
+			},
+		},
+		{
+			model: NormalizationFitted,
+			want:  map[gpuKey]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			n := newNormalizer(Config{NormalizationModel: tt.model, CPUMemoryRatio: DefaultCPUMemoryRatio}, records, testInstance)
+			if len(n.gpuShares) != len(tt.want) {
+				t.Fatalf("gpuShares = %v, want %v", n.gpuShares, tt.want)
+			}
+			for key, want := range tt.want {
+				if got, ok := n.gpuShares[key]; !ok || !almostEqual(got, want) {
+					t.Errorf("gpuShares[%v] = %v, want %v", key, got, want)
+				}
+			}
+			if _, ok := n.rates["us-east-1"]; ok {
+				t.Errorf("rates of us-east-1 fitted to GPU prices only")
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	records := []PriceRecord{
+		ondemandRecord("eu-west-1", "c5.large", linearPrice("c5.large")),
+		ondemandRecord("eu-west-1", "r5.large", linearPrice("r5.large")),
+		ondemandRecord("eu-west-1", "g4dn.xlarge", 0.736),
+		ondemandRecord("us-east-1", "m5.large", 0.092),
+	}
+
+	tests := []struct {
+		name   string
+		model  string
+		record PriceRecord
+		want   map[string]float64
+	}{
+		{
+			name:   "ratio",
+			model:  NormalizationRatio,
+			record: records[3],
+			// 0.092 / (7.2 * 2 + 8) per GB of memory
+			want: map[string]float64{"ec2_memory": 0.092 / 22.4, "ec2_vcpu": 7.2 * 0.092 / 22.4},
+		},
+		{
+			name:   "fitted",
+			model:  NormalizationFitted,
+			record: records[1],
+			want:   map[string]float64{"ec2_memory": 0.004, "ec2_vcpu": 0.03},
+		},
+		{
+			name:   "fitted region fallback",
+			model:  NormalizationFitted,
+			record: records[3],
+			want:   map[string]float64{"ec2_memory": 0.092 / 22.4, "ec2_vcpu": 7.2 * 0.092 / 22.4},
+		},
+		{
+			name:   "gpu",
+			model:  NormalizationGPU,
+			record: records[2],
+			want:   map[string]float64{"ec2_gpu": 0.552, "ec2_memory": 0.004, "ec2_vcpu": 0.03},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNormalizer(Config{NormalizationModel: tt.model, CPUMemoryRatio: DefaultCPUMemoryRatio}, records, testInstance)
+			normalized := n.normalize(tt.record)
+			if len(normalized) != len(tt.want) {
+				t.Fatalf("normalize() = %+v, want %v", normalized, tt.want)
+			}
+			for _, record := range normalized {
+				if want, ok := tt.want[record.Name]; !ok || !almostEqual(record.Value, want) {
+					t.Errorf("normalize() %s = %v, want %v", record.Name, record.Value, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,521 @@
+package exporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OfferFormatJSON = "json"
+	OfferFormatCSV  = "csv"
+
+	regionIndexFile = "region_index.json"
+	// offersService is the service of sources reading offer files, it calls no AWS API and is only bound by the global limit
+	offersService = "offers"
+)
+
+// csvAttributes maps the CSV offer file columns to the product attribute names of the JSON offer files and of the
+// Pricing API. Other columns are converted to lower camel case.
+var csvAttributes = map[string]string{
+	"CapacityStatus":         "capacitystatus",
+	"Current Generation":     "currentGeneration",
+	"Instance Family":        "instanceFamily",
+	"Instance Type":          "instanceType",
+	"License Model":          "licenseModel",
+	"Memory":                 "memory",
+	"Operating System":       "operatingSystem",
+	"Pre Installed S/W":      "preInstalledSw",
+	"Processor Architecture": "processorArchitecture",
+	"Region Code":            "regionCode",
+	"Tenancy":                "tenancy",
+	"usageType":              "usagetype",
+	"vCPU":                   "vcpu",
+	"Volume API Name":        "volumeApiName",
+}
+
+// offerFiles reads the AWS Price List bulk offer files of AmazonEC2, either from a local directory or from an URL
+// (e.g. https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonEC2/current).
+//
+// The location holds the region index (region_index.json). For an URL, the offer file of a region is the
+// currentVersionUrl of the index, for a directory it is <region>/index.json or <region>/index.csv.
+type offerFiles struct {
+	location string
+	format   string
+	client   *http.Client
+}
+
+// offerCache keeps the offer files downloaded from an URL on disk, so the sources reading them share a single download.
+// A cached file is revalidated with its ETag and Last-Modified headers and only downloaded again when it changed.
+type offerCache struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]*offerCacheEntry
+}
+
+type offerCacheEntry struct {
+	// mu is held during the download, so concurrent opens of the same URL wait for it
+	mu           sync.Mutex
+	path         string
+	valid        bool
+	etag         string
+	lastModified string
+}
+
+// offerFileCache is shared by all the sources and survives the configuration reloads.
+var offerFileCache = newOfferCache(filepath.Join(os.TempDir(), "ec2-price-exporter-offers"))
+
+type regionIndex struct {
+	Regions map[string]struct {
+		RegionCode        string `json:"regionCode"`
+		CurrentVersionURL string `json:"currentVersionUrl"`
+	} `json:"regions"`
+}
+
+func newOfferFiles(location, format string) *offerFiles {
+	return &offerFiles{
+		location: location,
+		format:   format,
+		client:   http.DefaultClient,
+	}
+}
+
+func (o *offerFiles) isURL() bool {
+	return strings.HasPrefix(o.location, "http://") || strings.HasPrefix(o.location, "https://")
+}
+
+// regions returns the regions listed in the region index.
+func (o *offerFiles) regions(ctx context.Context) ([]string, error) {
+	index, err := o.regionIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := make([]string, 0, len(index.Regions))
+	for region := range index.Regions {
+		regions = append(regions, region)
+	}
+
+	return regions, nil
+}
+
+// products returns the products of the region offer file the keep function returns true for, with their terms.
+func (o *offerFiles) products(ctx context.Context, region string, keep func(Product) bool) ([]Pricing, error) {
+	r, err := o.openRegion(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if o.format == OfferFormatCSV {
+		return decodeOfferCSV(r, keep)
+	}
+	return decodeOfferJSON(r, keep)
+}
+
+func (o *offerFiles) regionIndex(ctx context.Context) (regionIndex, error) {
+	var index regionIndex
+
+	r, err := o.open(ctx, regionIndexFile)
+	if err != nil {
+		return index, err
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return index, fmt.Errorf("invalid region index: %w", err)
+	}
+
+	return index, nil
+}
+
+func (o *offerFiles) openRegion(ctx context.Context, region string) (io.ReadCloser, error) {
+	if !o.isURL() {
+		return o.open(ctx, filepath.Join(region, "index."+o.format))
+	}
+
+	index, err := o.regionIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := index.Regions[region]
+	if !ok {
+		return nil, fmt.Errorf("region %s not found in the region index", region)
+	}
+
+	return o.open(ctx, strings.TrimSuffix(entry.CurrentVersionURL, ".json")+"."+o.format)
+}
+
+// open opens a file relative to the location. Absolute paths of an URL location are resolved against its host.
+func (o *offerFiles) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if !o.isURL() {
+		return os.Open(filepath.Join(o.location, name))
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(o.location, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return offerFileCache.open(ctx, o.client, base.ResolveReference(ref).String())
+}
+
+func newOfferCache(dir string) *offerCache {
+	return &offerCache{
+		dir:     dir,
+		entries: make(map[string]*offerCacheEntry),
+	}
+}
+
+func (c *offerCache) entry(location string) *offerCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[location]
+	if !ok {
+		sum := sha256.Sum256([]byte(location))
+		entry = &offerCacheEntry{path: filepath.Join(c.dir, hex.EncodeToString(sum[:]))}
+		c.entries[location] = entry
+	}
+
+	return entry
+}
+
+// open opens the cached file of the URL, downloading it first when it is not cached yet or changed.
+func (c *offerCache) open(ctx context.Context, client *http.Client, location string) (io.ReadCloser, error) {
+	entry := c.entry(location)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	if entry.valid && entry.etag != "" {
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+	if entry.valid && entry.lastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.lastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry.valid:
+		log.Debugf("Using cached offer file [url=%s]", location)
+	case resp.StatusCode == http.StatusOK:
+		if err := c.store(entry, resp.Body); err != nil {
+			return nil, fmt.Errorf("error while caching %s: %w", location, err)
+		}
+		entry.etag = resp.Header.Get("ETag")
+		entry.lastModified = resp.Header.Get("Last-Modified")
+	default:
+		return nil, fmt.Errorf("error while downloading %s: %s", location, resp.Status)
+	}
+
+	f, err := os.Open(entry.path)
+	if err != nil {
+		entry.valid = false
+		return nil, err
+	}
+	return f, nil
+}
+
+// store writes the downloaded file to a temporary file and moves it over the cached one, the readers of the previous
+// file keep reading it.
+func (c *offerCache) store(entry *offerCacheEntry, body io.Reader) error {
+	entry.valid = false
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), entry.path); err != nil {
+		return err
+	}
+
+	entry.valid = true
+	return nil
+}
+
+// openLocation opens a local file or downloads an URL.
+func openLocation(ctx context.Context, client *http.Client, location string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.Open(location)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error while downloading %s: %s", req.URL, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// decodeOfferJSON streams a JSON offer file, so only the kept products and their terms are held in memory.
+// The products have to precede the terms, as they do in the files published by AWS.
+func decodeOfferJSON(r io.Reader, keep func(Product) bool) ([]Pricing, error) {
+	dec := json.NewDecoder(r)
+	products := make(map[string]*Pricing)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "products":
+			err = decodeObject(dec, func(sku string) error {
+				var product Product
+				if err := dec.Decode(&product); err != nil {
+					return err
+				}
+				if keep(product) {
+					products[sku] = &Pricing{Product: product, ServiceCode: "AmazonEC2"}
+				}
+				return nil
+			})
+		case "terms":
+			err = decodeObject(dec, func(termType string) error {
+				return decodeObject(dec, func(sku string) error {
+					var terms map[string]SKU
+					if err := dec.Decode(&terms); err != nil {
+						return err
+					}
+					if pricing, ok := products[sku]; ok {
+						addTerms(pricing, termType, terms)
+					}
+					return nil
+				})
+			})
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid offer file: %w", err)
+		}
+	}
+
+	outs := make([]Pricing, 0, len(products))
+	for _, pricing := range products {
+		outs = append(outs, *pricing)
+	}
+
+	return outs, nil
+}
+
+// decodeOfferCSV reads a CSV offer file. Every row holds a single price dimension of a product term, along with all
+// the product attributes.
+func decodeOfferCSV(r io.Reader, keep func(Product) bool) ([]Pricing, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var header []string
+	products := make(map[string]*Pricing)
+	skipped := make(map[string]bool)
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid offer file: %w", err)
+		}
+
+		// the metadata lines (format version, publication date, ...) precede the header
+		if header == nil {
+			if len(row) > 0 && row[0] == "SKU" {
+				header = append([]string{}, row...)
+			}
+			continue
+		}
+
+		columns := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(row) {
+				columns[name] = row[i]
+			}
+		}
+
+		sku := columns["SKU"]
+		if skipped[sku] {
+			continue
+		}
+
+		pricing, ok := products[sku]
+		if !ok {
+			product := Product{
+				Sku:           sku,
+				ProductFamily: columns["Product Family"],
+				Attributes:    make(map[string]string),
+			}
+			for name, value := range columns {
+				if value != "" {
+					product.Attributes[csvAttributeName(name)] = value
+				}
+			}
+			if !keep(product) {
+				skipped[sku] = true
+				continue
+			}
+			pricing = &Pricing{Product: product, ServiceCode: "AmazonEC2"}
+			products[sku] = pricing
+		}
+
+		termKey := sku + "." + columns["OfferTermCode"]
+		term := SKU{
+			Sku:             sku,
+			OfferTermCode:   columns["OfferTermCode"],
+			EffectiveDate:   columns["EffectiveDate"],
+			PriceDimensions: map[string]Details{},
+			TermAttributes:  map[string]string{},
+		}
+		for _, attribute := range []string{"LeaseContractLength", "PurchaseOption", "OfferingClass"} {
+			if columns[attribute] != "" {
+				term.TermAttributes[attribute] = columns[attribute]
+			}
+		}
+		term.PriceDimensions[columns["RateCode"]] = Details{
+			Unit:         columns["Unit"],
+			Description:  columns["PriceDescription"],
+			RateCode:     columns["RateCode"],
+			BeginRange:   columns["StartingRange"],
+			EndRange:     columns["EndingRange"],
+			PricePerUnit: map[string]string{columns["Currency"]: columns["PricePerUnit"]},
+		}
+		addTerms(pricing, columns["TermType"], map[string]SKU{termKey: term})
+	}
+
+	outs := make([]Pricing, 0, len(products))
+	for _, pricing := range products {
+		outs = append(outs, *pricing)
+	}
+
+	return outs, nil
+}
+
+// addTerms merges the terms of a term type (OnDemand, Reserved) into the pricing of a product.
+func addTerms(pricing *Pricing, termType string, terms map[string]SKU) {
+	var target *map[string]SKU
+	switch termType {
+	case "OnDemand":
+		target = &pricing.Terms.OnDemand
+	case "Reserved":
+		target = &pricing.Terms.Reserved
+	default:
+		return
+	}
+	if *target == nil {
+		*target = make(map[string]SKU)
+	}
+
+	for key, term := range terms {
+		existing, ok := (*target)[key]
+		if !ok {
+			(*target)[key] = term
+			continue
+		}
+		for rateCode, details := range term.PriceDimensions {
+			existing.PriceDimensions[rateCode] = details
+		}
+	}
+}
+
+func csvAttributeName(column string) string {
+	if name, ok := csvAttributes[column]; ok {
+		return name
+	}
+
+	words := strings.FieldsFunc(column, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if i == 0 {
+			words[i] = strings.ToLower(word[:1]) + word[1:]
+		} else {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+
+	return strings.Join(words, "")
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("invalid offer file: expected %s, got %v", delim, token)
+	}
+	return nil
+}
+
+// decodeObject calls the decode function for every key of the next JSON object, the function has to consume the value.
+func decodeObject(dec *json.Decoder, decode func(key string) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("expected an object key, got %v", token)
+		}
+		if err := decode(key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
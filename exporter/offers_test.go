@@ -0,0 +1,225 @@
+package exporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const offerJSON = `{
+  "formatVersion": "v1.0",
+  "offerCode": "AmazonEC2",
+  "products": {
+    "C5LARGE": {
+      "sku": "C5LARGE",
+      "productFamily": "Compute Instance",
+      "attributes": {"instanceType": "c5.large", "operatingSystem": "Linux", "tenancy": "Shared", "memory": "4 GiB", "vcpu": "2"}
+    },
+    "C5LARGEWIN": {
+      "sku": "C5LARGEWIN",
+      "productFamily": "Compute Instance",
+      "attributes": {"instanceType": "c5.large", "operatingSystem": "Windows", "tenancy": "Shared"}
+    }
+  },
+  "terms": {
+    "OnDemand": {
+      "C5LARGE": {
+        "C5LARGE.JRTCKXETXF": {
+          "offerTermCode": "JRTCKXETXF",
+          "sku": "C5LARGE",
+          "priceDimensions": {
+            "C5LARGE.JRTCKXETXF.6YS6EN2CT7": {"unit": "Hrs", "beginRange": "0", "endRange": "Inf", "pricePerUnit": {"USD": "0.0960000000"}}
+          }
+        }
+      },
+      "C5LARGEWIN": {
+        "C5LARGEWIN.JRTCKXETXF": {
+          "offerTermCode": "JRTCKXETXF",
+          "sku": "C5LARGEWIN",
+          "priceDimensions": {
+            "C5LARGEWIN.JRTCKXETXF.6YS6EN2CT7": {"unit": "Hrs", "pricePerUnit": {"USD": "0.1880000000"}}
+          }
+        }
+      }
+    },
+    "Reserved": {
+      "C5LARGE": {
+        "C5LARGE.HU7G6KETJZ": {
+          "offerTermCode": "HU7G6KETJZ",
+          "sku": "C5LARGE",
+          "termAttributes": {"LeaseContractLength": "1yr", "OfferingClass": "standard", "PurchaseOption": "Partial Upfront"},
+          "priceDimensions": {
+            "C5LARGE.HU7G6KETJZ.2TG2D8R56U": {"unit": "Quantity", "pricePerUnit": {"USD": "250"}},
+            "C5LARGE.HU7G6KETJZ.6YS6EN2CT7": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0290000000"}}
+          }
+        }
+      }
+    }
+  }
+}`
+
+const offerCSV = `"FormatVersion","v1.0"
+"Disclaimer","This pricing list is for informational purposes only."
+"Publication Date","2023-01-01T00:00:00Z"
+"Version","20230101000000"
+"OfferCode","AmazonEC2"
+"SKU","OfferTermCode","RateCode","TermType","PriceDescription","EffectiveDate","StartingRange","EndingRange","Unit","PricePerUnit","Currency","LeaseContractLength","PurchaseOption","OfferingClass","Product Family","Instance Type","Operating System","Tenancy","Memory","vCPU","usageType"
+"C5LARGE","JRTCKXETXF","C5LARGE.JRTCKXETXF.6YS6EN2CT7","OnDemand","$0.096 per On Demand Linux c5.large Instance Hour","2023-01-01","0","Inf","Hrs","0.0960000000","USD","","","","Compute Instance","c5.large","Linux","Shared","4 GiB","2","EU-BoxUsage:c5.large"
+"C5LARGE","HU7G6KETJZ","C5LARGE.HU7G6KETJZ.2TG2D8R56U","Reserved","Upfront Fee","2023-01-01","","","Quantity","250","USD","1yr","Partial Upfront","standard","Compute Instance","c5.large","Linux","Shared","4 GiB","2","EU-BoxUsage:c5.large"
+"C5LARGE","HU7G6KETJZ","C5LARGE.HU7G6KETJZ.6YS6EN2CT7","Reserved","Linux/UNIX (Amazon VPC), c5.large reserved instance applied","2023-01-01","0","Inf","Hrs","0.0290000000","USD","1yr","Partial Upfront","standard","Compute Instance","c5.large","Linux","Shared","4 GiB","2","EU-BoxUsage:c5.large"
+"C5LARGEWIN","JRTCKXETXF","C5LARGEWIN.JRTCKXETXF.6YS6EN2CT7","OnDemand","$0.188 per On Demand Windows c5.large Instance Hour","2023-01-01","0","Inf","Hrs","0.1880000000","USD","","","","Compute Instance","c5.large","Windows","Shared","4 GiB","2","EU-BoxUsage:c5.large"
+`
+
+func keepLinux(product Product) bool {
+	return product.Attributes["operatingSystem"] == "Linux"
+}
+
+func TestDecodeOffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(io.Reader, func(Product) bool) ([]Pricing, error)
+		file   string
+	}{
+		{name: "json", decode: decodeOfferJSON, file: offerJSON},
+		{name: "csv", decode: decodeOfferCSV, file: offerCSV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outs, err := tt.decode(strings.NewReader(tt.file), keepLinux)
+			if err != nil {
+				t.Fatalf("decode error = %v", err)
+			}
+			if len(outs) != 1 {
+				t.Fatalf("decode returned %d products, want 1", len(outs))
+			}
+			out := outs[0]
+
+			if out.Product.Sku != "C5LARGE" || out.Product.ProductFamily != productFamilyInstance {
+				t.Errorf("product = %s %s, want C5LARGE %s", out.Product.Sku, out.Product.ProductFamily, productFamilyInstance)
+			}
+			for name, want := range map[string]string{"instanceType": "c5.large", "operatingSystem": "Linux", "memory": "4 GiB", "vcpu": "2"} {
+				if got := out.Product.Attributes[name]; got != want {
+					t.Errorf("attribute %s = %q, want %q", name, got, want)
+				}
+			}
+
+			value, currency, err := onDemandPrice(out)
+			if err != nil || value != 0.096 || currency != "USD" {
+				t.Errorf("onDemandPrice() = %v %s %v, want 0.096 USD", value, currency, err)
+			}
+
+			term, ok := out.Terms.Reserved["C5LARGE.HU7G6KETJZ"]
+			if !ok {
+				t.Fatalf("reserved term missing, got %v", out.Terms.Reserved)
+			}
+			if term.TermAttributes["PurchaseOption"] != "Partial Upfront" || term.TermAttributes["LeaseContractLength"] != "1yr" || term.TermAttributes["OfferingClass"] != "standard" {
+				t.Errorf("reserved term attributes = %v", term.TermAttributes)
+			}
+			hourly, upfront, currency, err := reservedPrices(term)
+			if err != nil || hourly != 0.029 || upfront != 250 || currency != "USD" {
+				t.Errorf("reservedPrices() = %v %v %s %v, want 0.029 250 USD", hourly, upfront, currency, err)
+			}
+		})
+	}
+}
+
+func TestDecodeOfferInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(io.Reader, func(Product) bool) ([]Pricing, error)
+		file   string
+	}{
+		{name: "json not an object", decode: decodeOfferJSON, file: `[]`},
+		{name: "json truncated", decode: decodeOfferJSON, file: `{"products": {"C5LARGE": {`},
+		{name: "csv bare quote", decode: decodeOfferCSV, file: "\"SKU\",\"TermType\"\n\"C5\"LARGE\",\"OnDemand\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.decode(strings.NewReader(tt.file), keepLinux); err == nil {
+				t.Error("decode error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestCSVAttributeName(t *testing.T) {
+	tests := []struct {
+		column string
+		want   string
+	}{
+		{column: "Instance Type", want: "instanceType"},
+		{column: "usageType", want: "usagetype"},
+		{column: "Physical Processor", want: "physicalProcessor"},
+		{column: "Dedicated EBS Throughput", want: "dedicatedEBSThroughput"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			if got := csvAttributeName(tt.column); got != tt.want {
+				t.Errorf("csvAttributeName(%q) = %q, want %q", tt.column, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOfferCacheRevalidates(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			requests = append(requests, "not modified")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		requests = append(requests, "download")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(offerJSON))
+	}))
+	defer server.Close()
+
+	cache := newOfferCache(t.TempDir())
+	for i := 0; i < 3; i++ {
+		r, err := cache.open(context.Background(), server.Client(), server.URL+"/eu-west-1/index.json")
+		if err != nil {
+			t.Fatalf("open error = %v", err)
+		}
+		outs, err := decodeOfferJSON(r, keepLinux)
+		r.Close()
+		if err != nil || len(outs) != 1 {
+			t.Fatalf("decode of the cached file = %d products, %v", len(outs), err)
+		}
+	}
+
+	want := []string{"download", "not modified", "not modified"}
+	if strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestOfferFilesRegions(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"regions": {
+			"eu-west-1": {"regionCode": "eu-west-1", "currentVersionUrl": "/offers/v1.0/aws/AmazonEC2/20230101/eu-west-1/index.json"},
+			"us-east-1": {"regionCode": "us-east-1", "currentVersionUrl": "/offers/v1.0/aws/AmazonEC2/20230101/us-east-1/index.json"}
+		}}`))
+	}))
+	defer server.Close()
+
+	offers := newOfferFiles(server.URL, OfferFormatJSON)
+	offers.client = server.Client()
+	previous := offerFileCache
+	offerFileCache = newOfferCache(dir)
+	t.Cleanup(func() { offerFileCache = previous })
+
+	regions, err := offers.regions(context.Background())
+	if err != nil {
+		t.Fatalf("regions error = %v", err)
+	}
+	sort.Strings(regions)
+	if strings.Join(regions, ",") != "eu-west-1,us-east-1" {
+		t.Errorf("regions() = %v, want [eu-west-1 us-east-1]", regions)
+	}
+}
@@ -2,16 +2,14 @@ package exporter
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
-	"sync/atomic"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
-	"github.com/aws/aws-sdk-go-v2/service/pricing"
-	pricingtypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -20,142 +18,251 @@ const (
 	TermPerHour  string = "6YS6EN2CT7"
 )
 
-func (e *Exporter) getOnDemandPricing(region string, scrapes chan<- scrapeResult) {
-	tmpCfg := e.awsCfg
-	tmpCfg.Region = "us-east-1" // this service is only available in us-east-1
-	pricingSvc := pricing.NewFromConfig(tmpCfg)
-
-	azs := e.getAZs(region)
-	pricelists := make([]pricing.GetProductsOutput, 0)
-	for _, os := range e.operatingSystems {
-		pag := pricing.NewGetProductsPaginator(
-			pricingSvc,
-			&pricing.GetProductsInput{
-				ServiceCode: aws.String("AmazonEC2"),
-				MaxResults:  aws.Int32(AwsMaxResultsPerPage),
-				Filters: []pricingtypes.Filter{
-					{
-						Field: aws.String("regionCode"),
-						Type:  pricingtypes.FilterTypeTermMatch,
-						Value: aws.String(region),
-					},
-					{
-						Field: aws.String("capacitystatus"),
-						Type:  pricingtypes.FilterTypeTermMatch,
-						Value: aws.String("Used"),
-					},
-					{
-						Field: aws.String("tenancy"),
-						Type:  pricingtypes.FilterTypeTermMatch,
-						Value: aws.String("Shared"),
-					},
-					{
-						Field: aws.String("preInstalledSw"),
-						Type:  pricingtypes.FilterTypeTermMatch,
-						Value: aws.String("NA"),
-					},
-					{
-						Field: aws.String("operatingSystem"),
-						Type:  pricingtypes.FilterTypeTermMatch,
-						Value: aws.String(os),
-					},
-				},
-			},
-		)
-		for pag.HasMorePages() {
-			pricelist, err := pag.NextPage(context.TODO())
-
-			if err != nil {
-				log.WithError(err).Errorf("error while fetching ondemand price [region=%s]", region)
-				atomic.AddUint64(&e.errorCount, 1)
-			}
+type onDemandSource struct {
+	*productsFetcher
+	regionOnly bool
+	localZones bool
+}
+
+func init() {
+	RegisterPriceSource("ondemand", newOnDemandSource)
+}
+
+func newOnDemandSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("ondemand", contains(cfg.Lifecycle, "ondemand")) {
+		return nil
+	}
+
+	return &onDemandSource{
+		productsFetcher: newProductsFetcher(cfg),
+		regionOnly:      cfg.OnDemandRegionOnly,
+		localZones:      cfg.LocalZones,
+	}
+}
 
-			pricelists = append(pricelists, *pricelist)
+func (s *onDemandSource) Name() string {
+	return "ondemand"
+}
+
+// FetchRegion returns the ondemand prices of the region, one per availability zone offering the instance type, along
+// with the instance type offerings. The offer files carry no availability zones, so in offline mode, or with
+// regionOnly, the prices are exported per region only.
+// Local Zones are priced apart from their region, their prices are fetched per zone group.
+func (s *onDemandSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	// availability zones by zone group, the region itself for the availability zones
+	groups := map[string][]string{region: {""}}
+	var offered map[string][]string
+	records := make([]PriceRecord, 0)
+	if s.offers == nil {
+		ec2Svc := ec2.NewFromConfig(cfg)
+		zones, err := getZones(ctx, ec2Svc, region, s.localZones)
+		if err != nil {
+			return nil, err
+		}
+		offered, err = getZoneOfferings(ctx, ec2Svc, region, zoneNames(zones))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, offeringRecords(region, zoneNames(zones), offered, s.instanceRegexes)...)
+
+		groups = make(map[string][]string)
+		for _, z := range zones {
+			groups[z.Group] = append(groups[z.Group], z.Name)
+		}
+		if s.regionOnly {
+			groups, offered = map[string][]string{region: {""}}, nil
 		}
 	}
 
-	outs := make([]Pricing, 0)
-	for _, pricelist := range pricelists {
-		for _, price := range pricelist.PriceList {
-			var tmp Pricing
-			log.Debug(price)
-			json.Unmarshal([]byte(price), &tmp)
-			outs = append(outs, tmp)
+	queries := s.instanceQueries()
+	if contains(s.tenancies, "Host") {
+		queries = append(queries, hostFilters())
+	}
+
+	for group, azs := range groups {
+		outs, err := s.fetchProducts(ctx, group, queries)
+		if err != nil {
+			return nil, err
 		}
+		records = append(records, s.priceRecords(region, azs, offered, outs)...)
 	}
 
+	return records, nil
+}
+
+// priceRecords converts the ondemand terms of the products into price records, one per availability zone. When the
+// offerings are known, only the zones offering the instance type, or a type of the dedicated host family, get a price.
+func (s *onDemandSource) priceRecords(region string, azs []string, offered map[string][]string, outs []Pricing) []PriceRecord {
+	records := make([]PriceRecord, 0)
 	for _, out := range outs {
-		if !isMatchAny(e.instanceRegexes, out.Product.Attributes["instanceType"]) {
+		if out.Product.ProductFamily == productFamilyHost {
+			hostAZs := azs
+			if offered != nil {
+				hostAZs = offeredZones(azs, familyZones(offered, hostFamily(out)))
+			}
+			records = append(records, hostRecords(region, hostAZs, out)...)
+			continue
+		}
+		if !isMatchAny(s.instanceRegexes, out.Product.Attributes["instanceType"]) {
 			log.Debugf("Skipping instance type: %s", out.Product.Attributes["instanceType"])
 			continue
 		}
 
-		sku := out.Product.Sku
-		skuOnDemand := fmt.Sprintf("%s.%s", sku, TermOnDemand)
-		skuOnDemandPerHour := fmt.Sprintf("%s.%s", skuOnDemand, TermPerHour)
-
-		value, err := strconv.ParseFloat(out.Terms.OnDemand[skuOnDemand].PriceDimensions[skuOnDemandPerHour].PricePerUnit["USD"], 64)
-
+		value, currency, err := onDemandPrice(out)
 		if err != nil {
-			log.WithError(err).Errorf("error while parsing spot price value from API response [region=%s, type=%s]", region, out.Product.Attributes["instanceType"])
-			atomic.AddUint64(&e.errorCount, 1)
+			log.WithError(err).Errorf("error while parsing ondemand price value from API response [region=%s, type=%s]", region, out.Product.Attributes["instanceType"])
+			continue
 		}
 		log.Debugf("Creating new metric: ec2{region=%s, instance_type=%s, product_description=%s} = %v.", region, out.Product.Attributes["instanceType"], out.Product.Attributes["operatingSystem"], value)
 
-		vcpu, memory := e.getNormalizedCost(value, out.Product.Attributes["instanceType"])
-		for _, az := range azs {
-			scrapes <- scrapeResult{
-				Name:               "ec2",
-				Value:              value,
-				Region:             region,
-				AvailabilityZone:   az,
-				InstanceType:       out.Product.Attributes["instanceType"],
-				InstanceLifecycle:  "ondemand",
-				OperatingSystem:    out.Product.Attributes["operatingSystem"],
-				ProductDescription: out.Product.Attributes["productDescription"],
-				Memory:             e.getInstanceMemory(out.Product.Attributes["instanceType"]),
-				VCpu:               e.getInstanceVCpu(out.Product.Attributes["instanceType"]),
-			}
-			scrapes <- scrapeResult{
-				Name:              "ec2_memory",
-				Value:             memory,
-				Region:            region,
-				AvailabilityZone:  az,
-				InstanceType:      out.Product.Attributes["instanceType"],
-				InstanceLifecycle: "ondemand",
-			}
-			scrapes <- scrapeResult{
-				Name:              "ec2_vcpu",
-				Value:             vcpu,
-				Region:            region,
-				AvailabilityZone:  az,
-				InstanceType:      out.Product.Attributes["instanceType"],
-				InstanceLifecycle: "ondemand",
-			}
+		instanceAZs := azs
+		if offered != nil {
+			instanceAZs = offeredZones(azs, offered[out.Product.Attributes["instanceType"]])
+		}
+		for _, az := range instanceAZs {
+			records = append(records, PriceRecord{
+				Name:                 "ec2",
+				Value:                value,
+				Currency:             currency,
+				Region:               region,
+				AvailabilityZone:     az,
+				InstanceType:         out.Product.Attributes["instanceType"],
+				InstanceLifecycle:    "ondemand",
+				Tenancy:              out.Product.Attributes["tenancy"],
+				CapacityStatus:       out.Product.Attributes["capacitystatus"],
+				OperatingSystem:      out.Product.Attributes["operatingSystem"],
+				PreInstalledSoftware: out.Product.Attributes["preInstalledSw"],
+				LicenseModel:         out.Product.Attributes["licenseModel"],
+				ProductDescription:   out.Product.Attributes["productDescription"],
+				Memory:               parseMemoryAttribute(out.Product.Attributes["memory"]),
+				VCpu:                 out.Product.Attributes["vcpu"],
+			})
 		}
 	}
 
+	return records
 }
 
-func (e *Exporter) getAZs(region string) []string {
-	ec2Svc := ec2.NewFromConfig(e.awsCfg)
-
-	tmpazs, err := ec2Svc.DescribeAvailabilityZones(context.TODO(), &ec2.DescribeAvailabilityZonesInput{
-		Filters: []ec2types.Filter{
-			{
-				Name:   aws.String("group-name"),
-				Values: []string{region},
-			},
-		}})
+// hostRecords returns the ondemand price of a dedicated host, one per availability zone.
+func hostRecords(region string, azs []string, out Pricing) []PriceRecord {
+	family := hostFamily(out)
 
+	value, currency, err := onDemandPrice(out)
 	if err != nil {
-		log.WithError(err).Fatalf("Couldn't describe AZs in %s", region)
+		log.WithError(err).Errorf("error while parsing dedicated host price value from API response [region=%s, family=%s]", region, family)
+		return nil
+	}
+	log.Debugf("Creating new metric: ec2_dedicated_host{region=%s, instance_family=%s} = %v.", region, family, value)
+
+	records := make([]PriceRecord, 0, len(azs))
+	for _, az := range azs {
+		records = append(records, PriceRecord{
+			Name:              "ec2_dedicated_host",
+			Value:             value,
+			Currency:          currency,
+			Region:            region,
+			AvailabilityZone:  az,
+			InstanceFamily:    family,
+			InstanceLifecycle: "ondemand",
+		})
+	}
+
+	return records
+}
+
+// hostFamily returns the instance family of a dedicated host product. The
+// instanceType attribute of a host holds its family, the usage type
+// (e.g. EUW1-HostUsage:m5) is used when it is missing.
+func hostFamily(out Pricing) string {
+	if family := out.Product.Attributes["instanceType"]; family != "" {
+		return family
+	}
+	_, family, _ := strings.Cut(out.Product.Attributes["usagetype"], "HostUsage:")
+	return family
+}
+
+// onDemandPrice returns the hourly price of the ondemand term of the product and its currency.
+func onDemandPrice(out Pricing) (float64, string, error) {
+	skuOnDemand := fmt.Sprintf("%s.%s", out.Product.Sku, TermOnDemand)
+	skuOnDemandPerHour := fmt.Sprintf("%s.%s", skuOnDemand, TermPerHour)
+
+	rawValue, currency := pricePerUnit(out.Terms.OnDemand[skuOnDemand].PriceDimensions[skuOnDemandPerHour])
+	value, err := strconv.ParseFloat(rawValue, 64)
+	return value, currency, err
+}
+
+// getZoneOfferings returns the availability zones among azs offering each instance type of the region.
+func getZoneOfferings(ctx context.Context, ec2Svc *ec2.Client, region string, azs []string) (map[string][]string, error) {
+	pag := ec2.NewDescribeInstanceTypeOfferingsPaginator(ec2Svc, &ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: ec2types.LocationTypeAvailabilityZone,
+		MaxResults:   aws.Int32(AwsMaxResultsPerPage),
+	})
+
+	offered := make(map[string][]string)
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error while describing instance type offerings in %s: %w", region, err)
+		}
+		for _, offering := range page.InstanceTypeOfferings {
+			instanceType, az := string(offering.InstanceType), aws.ToString(offering.Location)
+			if contains(azs, az) {
+				offered[instanceType] = append(offered[instanceType], az)
+			}
+		}
 	}
 
-	azs := make([]string, len(tmpazs.AvailabilityZones))
-	for i, az := range tmpazs.AvailabilityZones {
-		azs[i] = *az.ZoneName
+	return offered, nil
+}
+
+// offeredZones returns the availability zones of azs in offered.
+func offeredZones(azs []string, offered []string) []string {
+	zones := make([]string, 0, len(offered))
+	for _, az := range azs {
+		if contains(offered, az) {
+			zones = append(zones, az)
+		}
+	}
+	return zones
+}
+
+// familyZones returns the availability zones offering any instance type of the family.
+func familyZones(offered map[string][]string, family string) []string {
+	zones := make([]string, 0)
+	for instanceType, azs := range offered {
+		if typeFamily, _, _ := strings.Cut(instanceType, "."); typeFamily != family {
+			continue
+		}
+		for _, az := range azs {
+			if !contains(zones, az) {
+				zones = append(zones, az)
+			}
+		}
+	}
+	return zones
+}
+
+// offeringRecords tells, for every instance type matching the regexes, whether each availability zone offers it.
+func offeringRecords(region string, azs []string, offered map[string][]string, regexes []*regexp.Regexp) []PriceRecord {
+	records := make([]PriceRecord, 0)
+	for instanceType, offeredAZs := range offered {
+		if !isMatchAny(regexes, instanceType) {
+			continue
+		}
+		for _, az := range azs {
+			value := 0.0
+			if contains(offeredAZs, az) {
+				value = 1
+			}
+			records = append(records, PriceRecord{
+				Name:             "instance_type_offered",
+				Value:            value,
+				Region:           region,
+				AvailabilityZone: az,
+				InstanceType:     instanceType,
+			})
+		}
 	}
 
-	return azs
+	return records
 }
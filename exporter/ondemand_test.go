@@ -0,0 +1,121 @@
+package exporter
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func hostPricing(attributes map[string]string, price string) Pricing {
+	return Pricing{
+		Product: Product{
+			ProductFamily: productFamilyHost,
+			Attributes:    attributes,
+			Sku:           "HOSTSKU",
+		},
+		Terms: Terms{
+			OnDemand: map[string]SKU{
+				"HOSTSKU." + TermOnDemand: {
+					PriceDimensions: map[string]Details{
+						"HOSTSKU." + TermOnDemand + "." + TermPerHour: {
+							Unit:         "Hrs",
+							PricePerUnit: map[string]string{"USD": price},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestHostFamily(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string]string
+		want       string
+	}{
+		{
+			name: "instance type",
+			attributes: map[string]string{
+				"instanceFamily": "General purpose",
+				"instanceType":   "m5",
+				"usagetype":      "EUW1-HostUsage:m5",
+			},
+			want: "m5",
+		},
+		{
+			name: "usage type",
+			attributes: map[string]string{
+				"instanceFamily": "Compute optimized",
+				"usagetype":      "EUW1-HostUsage:c5",
+			},
+			want: "c5",
+		},
+		{
+			name:       "none",
+			attributes: map[string]string{"instanceFamily": "Memory optimized"},
+			want:       "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hostFamily(Pricing{Product: Product{Attributes: tt.attributes}}); got != tt.want {
+				t.Errorf("hostFamily() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceRecordsHostZones(t *testing.T) {
+	host := hostPricing(map[string]string{
+		"instanceFamily": "Compute optimized",
+		"instanceType":   "c5",
+		"usagetype":      "EUW1-HostUsage:c5",
+	}, "4.0880000000")
+	azs := []string{"eu-west-1a", "eu-west-1b", "eu-west-1c"}
+
+	tests := []struct {
+		name    string
+		offered map[string][]string
+		want    []string
+	}{
+		{
+			name:    "without offerings",
+			offered: nil,
+			want:    azs,
+		},
+		{
+			name: "family offered",
+			offered: map[string][]string{
+				"c5.large":  {"eu-west-1a"},
+				"c5.xlarge": {"eu-west-1a", "eu-west-1c"},
+				"m5.large":  {"eu-west-1b"},
+			},
+			want: []string{"eu-west-1a", "eu-west-1c"},
+		},
+		{
+			name: "family not offered",
+			offered: map[string][]string{
+				"c5n.large": {"eu-west-1a"},
+				"m5.large":  {"eu-west-1b"},
+			},
+			want: []string{},
+		},
+	}
+	s := &onDemandSource{productsFetcher: &productsFetcher{instanceRegexes: []*regexp.Regexp{regexp.MustCompile(".*")}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := s.priceRecords("eu-west-1", azs, tt.offered, []Pricing{host})
+			got := make([]string, 0, len(records))
+			for _, record := range records {
+				if record.Name != "ec2_dedicated_host" || record.InstanceFamily != "c5" || record.Value != 4.088 || record.Currency != "USD" {
+					t.Errorf("unexpected record %+v", record)
+				}
+				got = append(got, record.AvailabilityZone)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("priceRecords() zones = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
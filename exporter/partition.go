@@ -0,0 +1,106 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+const (
+	PartitionAWS      = "aws"
+	PartitionChina    = "aws-cn"
+	PartitionGovCloud = "aws-us-gov"
+)
+
+var (
+	validPartitions = []string{PartitionAWS, PartitionChina, PartitionGovCloud}
+
+	// partitionRegions are the regions the AWS configs of the partitions are loaded for.
+	partitionRegions = map[string]string{
+		PartitionAWS:      "us-east-1",
+		PartitionChina:    "cn-north-1",
+		PartitionGovCloud: "us-gov-west-1",
+	}
+
+	// pricingRegions are the regions of the Pricing API endpoints serving the prices of each partition, the GovCloud
+	// prices are served by the Pricing API of the aws partition.
+	pricingRegions = map[string]string{
+		PartitionAWS:      "us-east-1",
+		PartitionChina:    "cn-northwest-1",
+		PartitionGovCloud: "us-east-1",
+	}
+
+	// partitionCurrencies are the currencies the prices of each partition are listed in.
+	partitionCurrencies = map[string]string{
+		PartitionAWS:      "USD",
+		PartitionChina:    "CNY",
+		PartitionGovCloud: "USD",
+	}
+)
+
+// regionPartition returns the partition of the region.
+func regionPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return PartitionChina
+	case strings.HasPrefix(region, "us-gov-"):
+		return PartitionGovCloud
+	}
+	return PartitionAWS
+}
+
+// loadAWSConfigs loads the AWS config of every partition, from the shared config profile of the partition when one is
+// configured and from the default credential chain otherwise.
+func loadAWSConfigs(ctx context.Context, profiles map[string]string) (map[string]aws.Config, error) {
+	configs := make(map[string]aws.Config, len(validPartitions))
+	for _, partition := range validPartitions {
+		opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(partitionRegions[partition])}
+		if profile, ok := profiles[partition]; ok {
+			opts = append(opts, awsconfig.WithSharedConfigProfile(profile))
+		}
+
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("error while initializing aws config of partition %s: %w", partition, err)
+		}
+		configs[partition] = cfg
+	}
+
+	return configs, nil
+}
+
+// awsConfig returns the AWS config of the partition of the region, set to the region.
+func (c Config) awsConfig(region string) aws.Config {
+	cfg := c.awsConfigs[regionPartition(region)].Copy()
+	cfg.Region = region
+	return cfg
+}
+
+// pricingConfig returns the AWS config of the Pricing API endpoint serving the prices of the region.
+func (c Config) pricingConfig(region string) aws.Config {
+	return c.awsConfig(pricingRegions[regionPartition(region)])
+}
+
+// currency returns the currency of the record, the one of the partition of its region when the source didn't set it.
+func (r PriceRecord) currency() string {
+	if r.Currency != "" {
+		return r.Currency
+	}
+	return partitionCurrencies[regionPartition(r.Region)]
+}
+
+// pricePerUnit returns the price of the dimension and its currency, the price lists of a partition use a single one.
+func pricePerUnit(dimension Details) (string, string) {
+	for _, currency := range []string{"USD", "CNY"} {
+		if price, ok := dimension.PricePerUnit[currency]; ok {
+			return price, currency
+		}
+	}
+	for currency, price := range dimension.PricePerUnit {
+		return price, currency
+	}
+	return "", ""
+}
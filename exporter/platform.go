@@ -0,0 +1,63 @@
+package exporter
+
+var (
+	// platforms maps the product descriptions of the spot and saving plan prices, and the operating systems of the
+	// ondemand and reserved prices, to a common platform.
+	platforms = map[string]string{
+		// product descriptions
+		"Linux/UNIX":                            "linux",
+		"Linux/UNIX (Amazon VPC)":               "linux",
+		"SUSE Linux":                            "suse",
+		"SUSE Linux (Amazon VPC)":               "suse",
+		"Red Hat Enterprise Linux":              "rhel",
+		"Red Hat Enterprise Linux (Amazon VPC)": "rhel",
+		"Red Hat Enterprise Linux with HA":      "rhel-ha",
+		"Windows":                               "windows",
+		"Windows (Amazon VPC)":                  "windows",
+		"Windows BYOL":                          "windows-byol",
+		"Windows with SQL Server Standard":      "windows-sql-std",
+		"Windows with SQL Server Web":           "windows-sql-web",
+		"Windows with SQL Server Enterprise":    "windows-sql-ent",
+		"Linux with SQL Server Standard":        "linux-sql-std",
+		"Linux with SQL Server Web":             "linux-sql-web",
+		"Linux with SQL Server Enterprise":      "linux-sql-ent",
+		"RHEL with SQL Server Standard":         "rhel-sql-std",
+		"RHEL with SQL Server Web":              "rhel-sql-web",
+		"RHEL with SQL Server Enterprise":       "rhel-sql-ent",
+		"Ubuntu Pro":                            "ubuntu-pro",
+		// operating systems, Windows is shared with the product descriptions
+		"Linux": "linux",
+		"RHEL":  "rhel",
+		"SUSE":  "suse",
+	}
+
+	// platformSoftware maps the pre-installed software of the ondemand and reserved prices to the platform suffix.
+	platformSoftware = map[string]string{
+		"SQL Std": "-sql-std",
+		"SQL Web": "-sql-web",
+		"SQL Ent": "-sql-ent",
+	}
+
+	// legacyLabelNames are the labels replaced by the platform label, only exported with Config.LegacyLabels.
+	legacyLabelNames = []string{"product_description", "operating_system"}
+)
+
+// platform returns the platform of the record, empty when it is unknown. Platforms of the operating systems carry the
+// pre-installed software and the bring your own license model, like the product descriptions do.
+func (r PriceRecord) platform() string {
+	if r.Platform != "" {
+		return r.Platform
+	}
+	if r.OperatingSystem == "" {
+		return platforms[r.ProductDescription]
+	}
+
+	platform, ok := platforms[r.OperatingSystem]
+	if !ok {
+		return ""
+	}
+	if r.LicenseModel == "Bring your own license" {
+		return platform + "-byol"
+	}
+	return platform + platformSoftware[r.PreInstalledSoftware]
+}
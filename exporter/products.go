@@ -0,0 +1,255 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	pricingtypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	productFamilyInstance = "Compute Instance"
+	// productFamilyHost is the product family of the dedicated hosts, priced per host family.
+	productFamilyHost = "Dedicated Host"
+)
+
+// productsFetcher reads the products of a service (AmazonEC2 unless changed), along with their ondemand and reserved
+// terms, from the Pricing API or from the bulk offer files. It is shared by the sources pricing the terms.
+type productsFetcher struct {
+	serviceCode          string
+	operatingSystems     []string
+	preInstalledSoftware []string
+	licenseModels        []string
+	tenancies            []string
+	capacityStatuses     []string
+	instanceRegexes      []*regexp.Regexp
+	// pricingConfig returns the AWS config of the Pricing API endpoint of a region
+	pricingConfig func(region string) aws.Config
+	// offers replaces the Pricing API by the bulk offer files when set
+	offers *offerFiles
+}
+
+func newProductsFetcher(cfg Config) *productsFetcher {
+	f := &productsFetcher{
+		serviceCode:          "AmazonEC2",
+		operatingSystems:     cfg.OperatingSystems,
+		preInstalledSoftware: cfg.PreInstalledSoftware,
+		licenseModels:        cfg.LicenseModels,
+		tenancies:            cfg.Tenancies,
+		capacityStatuses:     cfg.CapacityStatuses,
+		instanceRegexes:      cfg.instanceRegexes,
+		pricingConfig:        cfg.pricingConfig,
+	}
+	if cfg.OfferFiles != "" {
+		f.offers = newOfferFiles(cfg.OfferFiles, cfg.OfferFilesFormat)
+	}
+
+	return f
+}
+
+func (f *productsFetcher) Service() string {
+	if f.offers != nil {
+		return offersService
+	}
+	return "pricing"
+}
+
+// instanceQueries returns the filters selecting the instance products of every configured operating system,
+// pre-installed software, tenancy, capacity status and license model. Software and license models not available with an operating
+// system are skipped for it. The Host tenancy is skipped too: instances on a dedicated host are priced by the host, their
+// instance products only carry a zero price.
+func (f *productsFetcher) instanceQueries() [][]priceFilter {
+	queries := make([][]priceFilter, 0)
+	for _, os := range f.operatingSystems {
+		for _, software := range f.preInstalledSoftware {
+			if !contains(validPreInstalledSoftware[os], software) {
+				continue
+			}
+			for _, tenancy := range f.tenancies {
+				if tenancy == "Host" {
+					continue
+				}
+				for _, status := range f.capacityStatuses {
+					filters := productFilters(os, software, tenancy, status)
+					if len(f.licenseModels) == 0 {
+						queries = append(queries, filters)
+						continue
+					}
+					for _, license := range f.licenseModels {
+						if !contains(validLicenseModels[os], license) {
+							continue
+						}
+						queries = append(queries, append(append([]priceFilter{}, filters...), priceFilter{field: "licenseModel", value: license}))
+					}
+				}
+			}
+		}
+	}
+	return queries
+}
+
+// fetchProducts returns the products of the region matching any of the queries. Instance products are also filtered by
+// the configured instance types.
+func (f *productsFetcher) fetchProducts(ctx context.Context, region string, queries [][]priceFilter) ([]Pricing, error) {
+	if f.offers != nil {
+		outs, err := f.offers.products(ctx, region, func(product Product) bool {
+			for _, query := range queries {
+				if matchFilters(product, query) && (product.ProductFamily != productFamilyInstance || isMatchAny(f.instanceRegexes, product.Attributes["instanceType"])) {
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error while reading offer file: %w", err)
+		}
+		return outs, nil
+	}
+
+	// the Pricing API is only available in a few regions of the partitions
+	pricingSvc := pricing.NewFromConfig(f.pricingConfig(region))
+
+	pricelists := make([]pricing.GetProductsOutput, 0)
+	for _, query := range queries {
+		filters := []pricingtypes.Filter{
+			{
+				Field: aws.String("regionCode"),
+				Type:  pricingtypes.FilterTypeTermMatch,
+				Value: aws.String(region),
+			},
+		}
+		for _, filter := range query {
+			filters = append(filters, pricingtypes.Filter{
+				Field: aws.String(filter.field),
+				Type:  pricingtypes.FilterTypeTermMatch,
+				Value: aws.String(filter.value),
+			})
+		}
+
+		pag := pricing.NewGetProductsPaginator(
+			pricingSvc,
+			&pricing.GetProductsInput{
+				ServiceCode: aws.String(f.serviceCode),
+				MaxResults:  aws.Int32(AwsMaxResultsPerPage),
+				Filters:     filters,
+			},
+		)
+		for pag.HasMorePages() {
+			pricelist, err := pag.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error while fetching products %v: %w", query, err)
+			}
+
+			pricelists = append(pricelists, *pricelist)
+		}
+	}
+
+	outs := make([]Pricing, 0)
+	for _, pricelist := range pricelists {
+		for _, price := range pricelist.PriceList {
+			var tmp Pricing
+			log.Debug(price)
+			json.Unmarshal([]byte(price), &tmp)
+			outs = append(outs, tmp)
+		}
+	}
+
+	return outs, nil
+}
+
+// chargedPrice returns the ondemand price of a product of any unit and its currency. Some prices start with a free range
+// (e.g. the first 3000 IOPS of gp3), the price of the lowest charged range is returned.
+func chargedPrice(out Pricing) (float64, string, error) {
+	type dimensionRange struct {
+		begin    float64
+		rateCode string
+		value    float64
+		currency string
+	}
+
+	ranges := make([]dimensionRange, 0)
+	for _, term := range out.Terms.OnDemand {
+		for _, dimension := range term.PriceDimensions {
+			rawValue, currency := pricePerUnit(dimension)
+			value, err := strconv.ParseFloat(rawValue, 64)
+			if err != nil {
+				return 0, "", err
+			}
+			begin, err := strconv.ParseFloat(dimension.BeginRange, 64)
+			if err != nil && dimension.BeginRange != "" {
+				return 0, "", fmt.Errorf("invalid begin range %s of %s: %w", dimension.BeginRange, dimension.RateCode, err)
+			}
+			ranges = append(ranges, dimensionRange{begin: begin, rateCode: dimension.RateCode, value: value, currency: currency})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].begin != ranges[j].begin {
+			return ranges[i].begin < ranges[j].begin
+		}
+		return ranges[i].rateCode < ranges[j].rateCode
+	})
+
+	for _, r := range ranges {
+		if r.value != 0 {
+			return r.value, r.currency, nil
+		}
+	}
+	if len(ranges) == 0 {
+		return 0, "", nil
+	}
+	return 0, ranges[0].currency, nil
+}
+
+// priceFilter is a product attribute the products are filtered by.
+type priceFilter struct {
+	field string
+	value string
+}
+
+// productFilters returns the product attributes selecting the instance products of the operating system, pre-installed
+// software, tenancy and capacity status, applied both to the Pricing API queries and to the offer files.
+func productFilters(os, software, tenancy, capacityStatus string) []priceFilter {
+	return []priceFilter{
+		{field: "capacitystatus", value: capacityStatus},
+		{field: "tenancy", value: tenancy},
+		{field: "preInstalledSw", value: software},
+		{field: "operatingSystem", value: os},
+	}
+}
+
+// hostFilters returns the product attributes selecting the dedicated hosts.
+func hostFilters() []priceFilter {
+	return []priceFilter{
+		{field: "productFamily", value: productFamilyHost},
+	}
+}
+
+func matchFilters(product Product, filters []priceFilter) bool {
+	for _, filter := range filters {
+		value := product.Attributes[filter.field]
+		if filter.field == "productFamily" {
+			value = product.ProductFamily
+		}
+		if value != filter.value {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMemoryAttribute converts the memory product attribute (e.g. "3.75 GiB") to MiB.
+func parseMemoryAttribute(memory string) string {
+	value, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSuffix(memory, " GiB"), ",", ""), 64)
+	if err != nil {
+		return ""
+	}
+	return strconv.Itoa(int(value * 1024))
+}
@@ -0,0 +1,93 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChargedPrice(t *testing.T) {
+	tests := []struct {
+		name       string
+		dimensions map[string]Details
+		want       float64
+	}{
+		{
+			name: "single range",
+			dimensions: map[string]Details{
+				"SKU.JRTCKXETXF.6YS6EN2CT7": {BeginRange: "0", EndRange: "Inf", PricePerUnit: map[string]string{"USD": "0.0880000000"}},
+			},
+			want: 0.088,
+		},
+		{
+			name: "free range first",
+			dimensions: map[string]Details{
+				"SKU.JRTCKXETXF.AAAAAAAAAA": {BeginRange: "3000", EndRange: "Inf", PricePerUnit: map[string]string{"USD": "0.0050000000"}},
+				"SKU.JRTCKXETXF.ZZZZZZZZZZ": {BeginRange: "0", EndRange: "3000", PricePerUnit: map[string]string{"USD": "0.0000000000"}},
+			},
+			want: 0.005,
+		},
+		{
+			name: "lowest charged range",
+			dimensions: map[string]Details{
+				"SKU.JRTCKXETXF.AAAAAAAAAA": {BeginRange: "16000", EndRange: "Inf", PricePerUnit: map[string]string{"USD": "0.0040000000"}},
+				"SKU.JRTCKXETXF.BBBBBBBBBB": {BeginRange: "3000", EndRange: "16000", PricePerUnit: map[string]string{"USD": "0.0050000000"}},
+				"SKU.JRTCKXETXF.CCCCCCCCCC": {BeginRange: "0", EndRange: "3000", PricePerUnit: map[string]string{"USD": "0.0000000000"}},
+			},
+			want: 0.005,
+		},
+		{
+			name: "free",
+			dimensions: map[string]Details{
+				"SKU.JRTCKXETXF.6YS6EN2CT7": {BeginRange: "0", EndRange: "Inf", PricePerUnit: map[string]string{"USD": "0.0000000000"}},
+			},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := Pricing{Terms: Terms{OnDemand: map[string]SKU{"SKU.JRTCKXETXF": {PriceDimensions: tt.dimensions}}}}
+			// the dimensions are maps, run a few times to catch an order dependency
+			for i := 0; i < 10; i++ {
+				got, currency, err := chargedPrice(out)
+				if err != nil {
+					t.Fatalf("chargedPrice() error = %v", err)
+				}
+				if got != tt.want || currency != "USD" {
+					t.Fatalf("chargedPrice() = %v %s, want %v USD", got, currency, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestInstanceQueriesSkipHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		tenancies []string
+		want      []string
+	}{
+		{name: "host with others", tenancies: []string{"Shared", "Host", "Dedicated"}, want: []string{"Shared", "Dedicated"}},
+		{name: "host only", tenancies: []string{"Host"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &productsFetcher{
+				operatingSystems:     []string{"Linux"},
+				preInstalledSoftware: []string{"NA"},
+				tenancies:            tt.tenancies,
+				capacityStatuses:     []string{"Used"},
+			}
+			got := make([]string, 0)
+			for _, query := range f.instanceQueries() {
+				for _, filter := range query {
+					if filter.field == "tenancy" {
+						got = append(got, filter.value)
+					}
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("instanceQueries() tenancies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
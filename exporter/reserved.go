@@ -0,0 +1,133 @@
+package exporter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// hoursPerYear is the number of hours AWS bills a reserved instance year for.
+const hoursPerYear = 8760
+
+type reservedSource struct {
+	*productsFetcher
+}
+
+func init() {
+	RegisterPriceSource("reserved", newReservedSource)
+}
+
+func newReservedSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("reserved", contains(cfg.Lifecycle, "reserved")) {
+		return nil
+	}
+
+	return &reservedSource{
+		productsFetcher: newProductsFetcher(cfg),
+	}
+}
+
+func (s *reservedSource) Name() string {
+	return "reserved"
+}
+
+// FetchRegion returns the reserved instance prices of the region, one per lease length, offering class and purchase
+// option. Reserved instances are priced per region, so the prices carry no availability zone.
+func (s *reservedSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	outs, err := s.fetchProducts(ctx, region, s.instanceQueries())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.priceRecords(region, outs), nil
+}
+
+// priceRecords converts the reserved terms of the products into the effective hourly price, with the upfront fee
+// amortized over the lease, and the raw upfront fee.
+func (s *reservedSource) priceRecords(region string, outs []Pricing) []PriceRecord {
+	records := make([]PriceRecord, 0)
+	for _, out := range outs {
+		instanceType := out.Product.Attributes["instanceType"]
+		if !isMatchAny(s.instanceRegexes, instanceType) {
+			log.Debugf("Skipping instance type: %s", instanceType)
+			continue
+		}
+
+		for _, term := range out.Terms.Reserved {
+			duration := leaseYears(term.TermAttributes["LeaseContractLength"])
+			if duration == 0 {
+				log.Errorf("error while parsing reserved lease length [region=%s, type=%s, lease=%s]", region, instanceType, term.TermAttributes["LeaseContractLength"])
+				continue
+			}
+
+			hourly, upfront, currency, err := reservedPrices(term)
+			if err != nil {
+				log.WithError(err).Errorf("error while parsing reserved price value from API response [region=%s, type=%s]", region, instanceType)
+				continue
+			}
+			value := hourly + upfront/float64(duration*hoursPerYear)
+			log.Debugf("Creating new metric: ec2{region=%s, instance_type=%s, operating_system=%s, reserved_option=%s, reserved_duration=%d} = %v.", region, instanceType, out.Product.Attributes["operatingSystem"], term.TermAttributes["PurchaseOption"], duration, value)
+
+			record := PriceRecord{
+				Name:                  "ec2",
+				Value:                 value,
+				Currency:              currency,
+				Region:                region,
+				InstanceType:          instanceType,
+				InstanceLifecycle:     "reserved",
+				Tenancy:               out.Product.Attributes["tenancy"],
+				CapacityStatus:        out.Product.Attributes["capacitystatus"],
+				OperatingSystem:       out.Product.Attributes["operatingSystem"],
+				PreInstalledSoftware:  out.Product.Attributes["preInstalledSw"],
+				LicenseModel:          out.Product.Attributes["licenseModel"],
+				ReservedOption:        term.TermAttributes["PurchaseOption"],
+				ReservedDuration:      duration,
+				ReservedOfferingClass: term.TermAttributes["OfferingClass"],
+				Memory:                parseMemoryAttribute(out.Product.Attributes["memory"]),
+				VCpu:                  out.Product.Attributes["vcpu"],
+			}
+			upfrontRecord := record
+			upfrontRecord.Name = "ec2_reserved_upfront"
+			upfrontRecord.Value = upfront
+
+			records = append(records, record, upfrontRecord)
+		}
+	}
+
+	return records
+}
+
+// reservedPrices returns the hourly usage price, the upfront fee and the currency of a reserved term.
+func reservedPrices(term SKU) (float64, float64, string, error) {
+	var hourly, upfront float64
+	var currency string
+	for _, dimension := range term.PriceDimensions {
+		rawValue, rawCurrency := pricePerUnit(dimension)
+		value, err := strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		currency = rawCurrency
+
+		switch dimension.Unit {
+		case "Hrs":
+			hourly = value
+		case "Quantity":
+			upfront = value
+		}
+	}
+
+	return hourly, upfront, currency, nil
+}
+
+// leaseYears converts a lease contract length (1yr, 3yr) to years, 0 when it can't be parsed.
+func leaseYears(lease string) int {
+	years, err := strconv.Atoi(strings.TrimSuffix(lease, "yr"))
+	if err != nil {
+		return 0
+	}
+	return years
+}
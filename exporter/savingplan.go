@@ -2,8 +2,9 @@ package exporter
 
 import (
 	"context"
+	"fmt"
+	"regexp"
 	"strconv"
-	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/savingsplans"
@@ -19,14 +20,51 @@ type savingPlanProperties struct {
 	Tenancy            string
 }
 
-func (e *Exporter) getSavingPlanPricing(region string, scrapes chan<- scrapeResult) {
-	tmpCfg := e.awsCfg
+// savingPlanTenancies maps the tenancies of the configuration to the tenancies of the Savings Plans API.
+var savingPlanTenancies = map[string]string{
+	"Shared":    "shared",
+	"Dedicated": "dedicated",
+	"Host":      "host",
+}
+
+type savingPlanSource struct {
+	productDescriptions []string
+	tenancies           []string
+	instanceRegexes     []*regexp.Regexp
+	savingPlanTypes     []string
+}
+
+func init() {
+	RegisterPriceSource("savingsplan", newSavingPlanSource)
+}
+
+func newSavingPlanSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("savingsplan", len(cfg.SavingPlanTypes) != 0) {
+		return nil
+	}
+
+	return &savingPlanSource{
+		productDescriptions: cfg.ProductDescriptions,
+		tenancies:           convertTenancies(cfg.Tenancies),
+		instanceRegexes:     cfg.instanceRegexes,
+		savingPlanTypes:     cfg.SavingPlanTypes,
+	}
+}
 
-	client := savingsplans.NewFromConfig(tmpCfg)
+func (s *savingPlanSource) Name() string {
+	return "savingsplan"
+}
+
+func (s *savingPlanSource) Service() string {
+	return "savingsplans"
+}
+
+func (s *savingPlanSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	client := savingsplans.NewFromConfig(cfg)
 
 	params := &savingsplans.DescribeSavingsPlansOfferingRatesInput{
 		MaxResults:       *aws.Int32((AwsMaxResultsPerPage)),
-		SavingsPlanTypes: convertSavingsPlanType(e.savingPlanTypes),
+		SavingsPlanTypes: convertSavingsPlanType(s.savingPlanTypes),
 		ServiceCodes:     []savingsplansTypes.SavingsPlanRateServiceCode{"AmazonEC2"},
 		Filters: []savingsplansTypes.SavingsPlanOfferingRateFilterElement{
 			{
@@ -35,11 +73,11 @@ func (e *Exporter) getSavingPlanPricing(region string, scrapes chan<- scrapeResu
 			},
 			{
 				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeTenancy,
-				Values: []string{"shared"},
+				Values: s.tenancies,
 			},
 			{
 				Name:   savingsplansTypes.SavingsPlanRateFilterAttributeProductDescription,
-				Values: e.productDescriptions,
+				Values: s.productDescriptions,
 			},
 		},
 	}
@@ -47,72 +85,61 @@ func (e *Exporter) getSavingPlanPricing(region string, scrapes chan<- scrapeResu
 	savingPlanList := make([]savingsplansTypes.SavingsPlanOfferingRate, 0)
 
 	for {
-		resp, err := client.DescribeSavingsPlansOfferingRates(context.TODO(), params)
-
+		resp, err := client.DescribeSavingsPlansOfferingRates(ctx, params)
 		if err != nil {
-			log.WithError(err).Errorf("error while fetching saving plans [region=%s]", region)
-			atomic.AddUint64(&e.errorCount, 1)
+			return nil, fmt.Errorf("error while fetching saving plans: %w", err)
 		}
 
 		savingPlanList = append(savingPlanList, resp.SearchResults...)
 
-		if *resp.NextToken == "" {
+		if aws.ToString(resp.NextToken) == "" {
 			break
 		}
 
 		params.NextToken = resp.NextToken
 	}
 
+	records := make([]PriceRecord, 0)
 	for _, plan := range savingPlanList {
 		planProperties := convertPropertiesToStruct(plan.Properties)
 
-		if !isMatchAny(e.instanceRegexes, planProperties.InstanceType) {
+		if !isMatchAny(s.instanceRegexes, planProperties.InstanceType) {
 			log.Debugf("Skipping instance type: %s", planProperties.InstanceType)
 			continue
 		}
 
+		if plan.Rate == nil || plan.SavingsPlanOffering == nil {
+			log.Errorf("missing saving plan rate or offering in API response [region=%s, type=%s]", region, planProperties.InstanceType)
+			continue
+		}
 		value, err := strconv.ParseFloat(*plan.Rate, 64)
 		if err != nil {
 			log.WithError(err).Errorf("error while parsing saving plan price value from API response [region=%s, type=%s]", region, planProperties.InstanceType)
-			atomic.AddUint64(&e.errorCount, 1)
+			continue
+		}
+		duration, err := SecondsToYears(plan.SavingsPlanOffering.DurationSeconds)
+		if err != nil {
+			log.WithError(err).Errorf("error while parsing saving plan duration from API response [region=%s, type=%s]", region, planProperties.InstanceType)
+			continue
 		}
 		log.Debugf("Creating new metric: ec2{region=%s, instance_type=%s, product_description=%s} = %v.", region, planProperties.InstanceType, planProperties.ProductDescription, value)
 
-		vcpu, memory := e.getNormalizedCost(value, planProperties.InstanceType)
-		scrapes <- scrapeResult{
+		records = append(records, PriceRecord{
 			Name:               "ec2",
 			Value:              value,
 			Region:             region,
 			InstanceType:       planProperties.InstanceType,
 			InstanceLifecycle:  "ondemand",
+			Tenancy:            tenancyName(planProperties.Tenancy),
 			ProductDescription: planProperties.ProductDescription,
 			SavingPlanOption:   string(plan.SavingsPlanOffering.PaymentOption),
-			SavingPlanDuration: SecondsToYears(plan.SavingsPlanOffering.DurationSeconds),
+			SavingPlanDuration: duration,
 			SavingPlanType:     string(plan.SavingsPlanOffering.PlanType),
-			Memory:             e.getInstanceMemory(planProperties.InstanceType),
-			VCpu:               e.getInstanceVCpu(planProperties.InstanceType),
-		}
-		scrapes <- scrapeResult{
-			Name:               "ec2_memory",
-			Value:              memory,
-			Region:             region,
-			InstanceType:       planProperties.InstanceType,
-			InstanceLifecycle:  "ondemand",
-			SavingPlanOption:   string(plan.SavingsPlanOffering.PaymentOption),
-			SavingPlanDuration: SecondsToYears(plan.SavingsPlanOffering.DurationSeconds),
-			SavingPlanType:     string(plan.SavingsPlanOffering.PlanType),
-		}
-		scrapes <- scrapeResult{
-			Name:               "ec2_vcpu",
-			Value:              vcpu,
-			Region:             region,
-			InstanceType:       planProperties.InstanceType,
-			InstanceLifecycle:  "ondemand",
-			SavingPlanOption:   string(plan.SavingsPlanOffering.PaymentOption),
-			SavingPlanDuration: SecondsToYears(plan.SavingsPlanOffering.DurationSeconds),
-			SavingPlanType:     string(plan.SavingsPlanOffering.PlanType),
-		}
+			Currency:           string(plan.SavingsPlanOffering.Currency),
+		})
 	}
+
+	return records, nil
 }
 
 func convertSavingsPlanType(spt []string) []savingsplansTypes.SavingsPlanType {
@@ -125,6 +152,26 @@ func convertSavingsPlanType(spt []string) []savingsplansTypes.SavingsPlanType {
 	return result
 }
 
+func convertTenancies(tenancies []string) []string {
+	result := make([]string, 0, len(tenancies))
+
+	for _, v := range tenancies {
+		result = append(result, savingPlanTenancies[v])
+	}
+
+	return result
+}
+
+// tenancyName returns the tenancy of the configuration matching a tenancy of the Savings Plans API.
+func tenancyName(tenancy string) string {
+	for name, v := range savingPlanTenancies {
+		if v == tenancy {
+			return name
+		}
+	}
+	return tenancy
+}
+
 func convertPropertiesToStruct(properties []savingsplansTypes.SavingsPlanOfferingRateProperty) savingPlanProperties {
 	result := savingPlanProperties{}
 
@@ -148,14 +195,15 @@ func convertPropertiesToStruct(properties []savingsplansTypes.SavingsPlanOfferin
 	return result
 }
 
-func SecondsToYears(seconds int64) int {
+// SecondsToYears converts the duration of a saving plan to years, saving plans last 1 or 3 years.
+func SecondsToYears(seconds int64) (int, error) {
 	const secondsPerYear = 31536000 // seconds in 1 year
 
 	years := seconds / secondsPerYear
 
 	if years != 1 && years != 3 {
-		panic("Value could be only 1 or 3.")
+		return 0, fmt.Errorf("saving plan duration of %d seconds is not 1 or 3 years", seconds)
 	}
 
-	return int(years)
+	return int(years), nil
 }
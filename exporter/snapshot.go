@@ -0,0 +1,97 @@
+package exporter
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// snapshotKey identifies the prices fetched by one source in one region.
+type snapshotKey struct {
+	Source string
+	Region string
+}
+
+// regionSnapshot holds the records of the last successful fetch of a source in a region.
+type regionSnapshot struct {
+	UpdatedAt time.Time
+	Records   []PriceRecord
+}
+
+// snapshotStore keeps the last good snapshot of every (source, region) pair. A snapshot is only replaced by a
+// successful fetch, so a failing region keeps serving its previous prices until it gets too stale.
+type snapshotStore struct {
+	snapshots map[snapshotKey]regionSnapshot
+	sync.RWMutex
+}
+
+func newSnapshotStore() *snapshotStore {
+	return &snapshotStore{
+		snapshots: make(map[snapshotKey]regionSnapshot),
+	}
+}
+
+func (s *snapshotStore) set(key snapshotKey, snapshot regionSnapshot) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.snapshots[key] = snapshot
+}
+
+// prune drops the snapshots the drop function returns true for and returns their keys.
+func (s *snapshotStore) prune(drop func(key snapshotKey, snapshot regionSnapshot) bool) []snapshotKey {
+	s.Lock()
+	defer s.Unlock()
+
+	dropped := make([]snapshotKey, 0)
+	for key, snapshot := range s.snapshots {
+		if drop(key, snapshot) {
+			delete(s.snapshots, key)
+			dropped = append(dropped, key)
+		}
+	}
+
+	return dropped
+}
+
+// records returns the records of all snapshots.
+func (s *snapshotStore) records() []PriceRecord {
+	s.RLock()
+	defer s.RUnlock()
+
+	records := make([]PriceRecord, 0)
+	for _, key := range s.sortedKeys() {
+		records = append(records, s.snapshots[key].Records...)
+	}
+
+	return records
+}
+
+// updated returns the time of the last successful fetch of every snapshot.
+func (s *snapshotStore) updated() map[snapshotKey]time.Time {
+	s.RLock()
+	defer s.RUnlock()
+
+	updated := make(map[snapshotKey]time.Time, len(s.snapshots))
+	for key, snapshot := range s.snapshots {
+		updated[key] = snapshot.UpdatedAt
+	}
+
+	return updated
+}
+
+// sortedKeys returns the keys in a stable order, so later snapshots win deterministically on duplicate series.
+func (s *snapshotStore) sortedKeys() []snapshotKey {
+	keys := make([]snapshotKey, 0, len(s.snapshots))
+	for key := range s.snapshots {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Source != keys[j].Source {
+			return keys[i].Source < keys[j].Source
+		}
+		return keys[i].Region < keys[j].Region
+	})
+
+	return keys
+}
@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotFileVersion is bumped whenever the layout of the snapshot file or of PriceRecord changes incompatibly.
+// Files of another version are ignored.
+const snapshotFileVersion = 2
+
+// snapshotFile is the on-disk representation of the snapshot store.
+type snapshotFile struct {
+	Version   int                 `json:"version"`
+	WrittenAt time.Time           `json:"written_at"`
+	Snapshots []snapshotFileEntry `json:"snapshots"`
+}
+
+type snapshotFileEntry struct {
+	Source    string        `json:"source"`
+	Region    string        `json:"region"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Records   []PriceRecord `json:"records"`
+}
+
+// save writes all snapshots to the file. The file is replaced atomically, so a crash never leaves a partial snapshot behind.
+func (s *snapshotStore) save(path string, now time.Time) error {
+	s.RLock()
+	file := snapshotFile{
+		Version:   snapshotFileVersion,
+		WrittenAt: now,
+		Snapshots: make([]snapshotFileEntry, 0, len(s.snapshots)),
+	}
+	for _, key := range s.sortedKeys() {
+		snapshot := s.snapshots[key]
+		file.Snapshots = append(file.Snapshots, snapshotFileEntry{
+			Source:    key.Source,
+			Region:    key.Region,
+			UpdatedAt: snapshot.UpdatedAt,
+			Records:   snapshot.Records,
+		})
+	}
+	s.RUnlock()
+
+	content, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// load reads the snapshots of the file into the store and returns the time the file was written.
+func (s *snapshotStore) load(path string) (time.Time, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var file snapshotFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return time.Time{}, fmt.Errorf("invalid snapshot file: %w", err)
+	}
+	if file.Version != snapshotFileVersion {
+		return time.Time{}, fmt.Errorf("unsupported snapshot file version %d, expected %d", file.Version, snapshotFileVersion)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, entry := range file.Snapshots {
+		s.snapshots[snapshotKey{Source: entry.Source, Region: entry.Region}] = regionSnapshot{
+			UpdatedAt: entry.UpdatedAt,
+			Records:   entry.Records,
+		}
+	}
+
+	return file.WrittenAt, nil
+}
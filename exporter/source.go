@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// PriceSource fetches one kind of prices (spot, ondemand, saving plans, ...) for a single region.
+// Sources are registered with RegisterPriceSource and built by the exporter from its Config.
+type PriceSource interface {
+	// Name identifies the source in logs and metrics.
+	Name() string
+	// Service is the AWS service the source calls (e.g. ec2, pricing), used to apply the per-service concurrency limit.
+	Service() string
+	// FetchRegion returns all price records of the source for the region. The config is already set to the region.
+	// An error means the region could not be fetched and none of the returned records should be used.
+	FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error)
+}
+
+// SourceFactory builds a PriceSource from the exporter configuration. It returns nil when the source is disabled by the configuration,
+// see Config.SourceEnabled.
+type SourceFactory func(cfg Config) PriceSource
+
+// PriceRecord is a single price returned by a PriceSource. Name is the metric the price is exported as (e.g. ec2), labels
+// that do not apply to the source are left empty. Memory (MiB) and VCpu of ec2 records are filled from the instance type
+// catalog, values set by the source are only used for types missing in it.
+type PriceRecord struct {
+	Name              string
+	Value             float64
+	Region            string
+	AvailabilityZone  string
+	InstanceType      string
+	InstanceFamily    string
+	InstanceLifecycle string
+	// Tenancy is the tenancy of the instance (Shared, Dedicated, Host)
+	Tenancy string
+	// CapacityStatus tells apart the ondemand prices of instances (Used) and of capacity reservations
+	CapacityStatus     string
+	ProductDescription string
+	OperatingSystem    string
+	// Platform overrides the platform mapped from the product description or the operating system
+	Platform string
+	// PreInstalledSoftware (NA, SQL Std, ...) and LicenseModel of the ondemand and reserved instances
+	PreInstalledSoftware string
+	LicenseModel         string
+	SavingPlanOption     string
+	SavingPlanDuration   int
+	SavingPlanType       string
+	// ReservedOption is the purchase option of a reserved instance (No Upfront, Partial Upfront, All Upfront)
+	ReservedOption        string
+	ReservedDuration      int
+	ReservedOfferingClass string
+	Memory                string
+	VCpu                  string
+	// Architecture is the processor architecture of Fargate tasks (x86_64, arm64)
+	Architecture string
+	// InterruptionFrequency is the interruption range of a spot instance (e.g. <5%)
+	InterruptionFrequency string
+	// TargetCapacity is the number of instances a Spot placement score is requested for
+	TargetCapacity int
+	// VolumeType is the EBS volume type (gp3, io2, ...) and Tier the pricing tier of tiered prices
+	VolumeType string
+	Tier       string
+	// Currency of the price (USD, CNY), the currency of the partition of the region when empty
+	Currency string
+	// ZoneID, ZoneType, ParentZone and ZoneGroup describe the availability zone of a zone info record
+	ZoneID     string
+	ZoneType   string
+	ParentZone string
+	ZoneGroup  string
+}
+
+// refreshKey is the context key of the start of the refresh a fetch belongs to.
+type refreshKey struct{}
+
+// withRefresh returns a context carrying the start of the refresh, the sources use it to share work between the
+// regions of a refresh.
+func withRefresh(ctx context.Context, start time.Time) context.Context {
+	return context.WithValue(ctx, refreshKey{}, start)
+}
+
+// refreshStart returns the start of the refresh the fetch belongs to, zero outside of a refresh.
+func refreshStart(ctx context.Context) time.Time {
+	start, _ := ctx.Value(refreshKey{}).(time.Time)
+	return start
+}
+
+var (
+	sourceRegistry    = map[string]SourceFactory{}
+	sourceRegistryMtx sync.Mutex
+)
+
+// RegisterPriceSource makes a price source available to the exporter under the given name.
+// It is meant to be called from init functions and panics when the name is already taken.
+func RegisterPriceSource(name string, factory SourceFactory) {
+	sourceRegistryMtx.Lock()
+	defer sourceRegistryMtx.Unlock()
+
+	if _, ok := sourceRegistry[name]; ok {
+		panic(fmt.Sprintf("price source %s is already registered", name))
+	}
+	sourceRegistry[name] = factory
+}
+
+// isRegisteredSource tells whether a source is registered under the name.
+func isRegisteredSource(name string) bool {
+	sourceRegistryMtx.Lock()
+	defer sourceRegistryMtx.Unlock()
+
+	_, ok := sourceRegistry[name]
+	return ok
+}
+
+// registeredSources returns the names of all registered sources, sorted.
+func registeredSources() []string {
+	sourceRegistryMtx.Lock()
+	defer sourceRegistryMtx.Unlock()
+
+	return sortedSourceNames()
+}
+
+func sortedSourceNames() []string {
+	names := make([]string, 0, len(sourceRegistry))
+	for name := range sourceRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// newPriceSources builds every registered source enabled by the configuration, ordered by name.
+func newPriceSources(cfg Config) []PriceSource {
+	sourceRegistryMtx.Lock()
+	defer sourceRegistryMtx.Unlock()
+
+	names := sortedSourceNames()
+	sources := make([]PriceSource, 0, len(names))
+	for _, name := range names {
+		if source := sourceRegistry[name](cfg); source != nil {
+			sources = append(sources, source)
+		}
+	}
+
+	return sources
+}
@@ -2,8 +2,12 @@ package exporter
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
 	"strconv"
-	"sync/atomic"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -11,24 +15,154 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func (e *Exporter) getSpotPricing(region string, scrapes chan<- scrapeResult) {
-	ec2Svc := ec2.NewFromConfig(e.awsCfg)
-	pag := ec2.NewDescribeSpotPriceHistoryPaginator(
-		ec2Svc,
-		&ec2.DescribeSpotPriceHistoryInput{
-			StartTime:           aws.Time(time.Now()),
-			MaxResults:          aws.Int32(AwsMaxResultsPerPage),
-			ProductDescriptions: e.productDescriptions,
-		})
+// spotPriceHistoryMaxResults is the largest page of DescribeSpotPriceHistory.
+const spotPriceHistoryMaxResults int32 = 1000
+
+type spotSource struct {
+	productDescriptions []string
+	instanceRegexes     []*regexp.Regexp
+	historyWindow       time.Duration
+
+	mu sync.Mutex
+	// histories hold the price changes of the window of every region, the next fetch only asks for the newer ones
+	histories map[string]spotHistory
+}
+
+// spotHistory is the price history of a region, fetched up to fetchedAt.
+type spotHistory struct {
+	fetchedAt time.Time
+	points    map[spotKey][]spotPoint
+}
+
+// spotKey identifies the price history of an instance type in an availability zone.
+type spotKey struct {
+	availabilityZone   string
+	instanceType       string
+	productDescription string
+}
+
+// spotPoint is a spot price change.
+type spotPoint struct {
+	timestamp time.Time
+	value     float64
+}
+
+func init() {
+	RegisterPriceSource("spot", newSpotSource)
+}
+
+func newSpotSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("spot", contains(cfg.Lifecycle, "spot")) {
+		return nil
+	}
+
+	return &spotSource{
+		productDescriptions: cfg.ProductDescriptions,
+		instanceRegexes:     cfg.instanceRegexes,
+		historyWindow:       cfg.SpotHistoryWindow,
+		histories:           make(map[string]spotHistory),
+	}
+}
+
+func (s *spotSource) Name() string {
+	return "spot"
+}
+
+func (s *spotSource) Service() string {
+	return "ec2"
+}
+
+// FetchRegion returns the current spot prices of the region. With a history window, the price changes of the window
+// are kept too and summarized in the spot price statistics; the whole window is fetched once, the next fetches only
+// ask for the changes since the previous one.
+func (s *spotSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	now := time.Now()
+	start := now.Add(-s.historyWindow)
+
+	s.mu.Lock()
+	previous := s.histories[region]
+	s.mu.Unlock()
+
+	fetchStart := start
+	if previous.points != nil && previous.fetchedAt.After(start) {
+		fetchStart = previous.fetchedAt
+	}
+	changes, err := s.fetchHistory(ctx, cfg, region, fetchStart, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// instance types missing in the fetch aren't offered anymore, their history is dropped
+	history := make(map[spotKey][]spotPoint, len(changes))
+	for key, points := range changes {
+		history[key] = trimSpotPoints(mergeSpotPoints(previous.points[key], points), start)
+	}
+	if s.historyWindow > 0 {
+		s.mu.Lock()
+		s.histories[region] = spotHistory{fetchedAt: now, points: history}
+		s.mu.Unlock()
+	}
+
+	records := make([]PriceRecord, 0, len(history))
+	for key, points := range history {
+		record := PriceRecord{
+			Name:               "ec2",
+			Value:              points[len(points)-1].value,
+			Region:             region,
+			AvailabilityZone:   key.availabilityZone,
+			InstanceType:       key.instanceType,
+			InstanceLifecycle:  "spot",
+			Tenancy:            "Shared",
+			ProductDescription: key.productDescription,
+		}
+		log.Debugf("Creating new metric: ec2{region=%s, az=%s, instance_type=%s, product_description=%s} = %v.", region, key.availabilityZone, key.instanceType, key.productDescription, record.Value)
+		records = append(records, record)
+
+		if s.historyWindow == 0 {
+			continue
+		}
+
+		stats := spotHistoryStats(points, start, now)
+		for name, value := range map[string]float64{
+			"ec2_spot_price_min":     stats.min,
+			"ec2_spot_price_max":     stats.max,
+			"ec2_spot_price_mean":    stats.mean,
+			"ec2_spot_price_stddev":  stats.stddev,
+			"ec2_spot_price_changes": float64(stats.changes),
+		} {
+			stat := record
+			stat.Name = name
+			stat.Value = value
+			records = append(records, stat)
+		}
+	}
+
+	return records, nil
+}
+
+// fetchHistory returns the spot price changes from start to end of the instance types matching the regexes, sorted by
+// time. The price in effect at start is included.
+func (s *spotSource) fetchHistory(ctx context.Context, cfg aws.Config, region string, start, end time.Time) (map[spotKey][]spotPoint, error) {
+	history := make(map[spotKey][]spotPoint)
+
+	input := &ec2.DescribeSpotPriceHistoryInput{
+		StartTime:           aws.Time(start),
+		MaxResults:          aws.Int32(spotPriceHistoryMaxResults),
+		ProductDescriptions: s.productDescriptions,
+	}
+	if s.historyWindow > 0 {
+		input.EndTime = aws.Time(end)
+	}
+
+	ec2Svc := ec2.NewFromConfig(cfg)
+	pag := ec2.NewDescribeSpotPriceHistoryPaginator(ec2Svc, input)
 	for pag.HasMorePages() {
-		history, err := pag.NextPage(context.TODO())
+		page, err := pag.NextPage(ctx)
 		if err != nil {
-			log.WithError(err).Errorf("error while fetching spot price history [region=%s]", region)
-			atomic.AddUint64(&e.errorCount, 1)
-			break
+			return nil, fmt.Errorf("error while fetching spot price history: %w", err)
 		}
-		for _, price := range history.SpotPriceHistory {
-			if !isMatchAny(e.instanceRegexes, string(price.InstanceType)) {
+		for _, price := range page.SpotPriceHistory {
+			if !isMatchAny(s.instanceRegexes, string(price.InstanceType)) {
 				log.Debugf("Skipping instance type: %s", price.InstanceType)
 				continue
 			}
@@ -36,39 +170,92 @@ func (e *Exporter) getSpotPricing(region string, scrapes chan<- scrapeResult) {
 			value, err := strconv.ParseFloat(*price.SpotPrice, 64)
 			if err != nil {
 				log.WithError(err).Errorf("error while parsing spot price value from API response [region=%s, az=%s, type=%s]", region, *price.AvailabilityZone, price.InstanceType)
-				atomic.AddUint64(&e.errorCount, 1)
-			}
-			log.Debugf("Creating new metric: ec2{region=%s, az=%s, instance_type=%s, product_description=%s} = %v.", region, *price.AvailabilityZone, price.InstanceType, price.ProductDescription, value)
-
-			scrapes <- scrapeResult{
-				Name:               "ec2",
-				Value:              value,
-				Region:             region,
-				AvailabilityZone:   *price.AvailabilityZone,
-				InstanceType:       string(price.InstanceType),
-				InstanceLifecycle:  "spot",
-				ProductDescription: string(price.ProductDescription),
-				Memory:             e.getInstanceMemory(string(price.InstanceType)),
-				VCpu:               e.getInstanceVCpu(string(price.InstanceType)),
+				continue
 			}
 
-			vcpu, memory := e.getNormalizedCost(value, string(price.InstanceType))
-			scrapes <- scrapeResult{
-				Name:              "ec2_memory",
-				Value:             memory,
-				Region:            region,
-				AvailabilityZone:  *price.AvailabilityZone,
-				InstanceType:      string(price.InstanceType),
-				InstanceLifecycle: "spot",
-			}
-			scrapes <- scrapeResult{
-				Name:              "ec2_vcpu",
-				Value:             vcpu,
-				Region:            region,
-				AvailabilityZone:  *price.AvailabilityZone,
-				InstanceType:      string(price.InstanceType),
-				InstanceLifecycle: "spot",
+			key := spotKey{
+				availabilityZone:   aws.ToString(price.AvailabilityZone),
+				instanceType:       string(price.InstanceType),
+				productDescription: string(price.ProductDescription),
 			}
+			history[key] = append(history[key], spotPoint{timestamp: aws.ToTime(price.Timestamp), value: value})
+		}
+	}
+
+	for _, points := range history {
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].timestamp.Before(points[j].timestamp)
+		})
+	}
+
+	return history, nil
+}
+
+// mergeSpotPoints appends the newer changes to the known ones, both sorted by time. The changes already known, e.g. the
+// price in effect at the start of an incremental fetch, are skipped.
+func mergeSpotPoints(known, changes []spotPoint) []spotPoint {
+	merged := append(make([]spotPoint, 0, len(known)+len(changes)), known...)
+	for _, change := range changes {
+		if len(merged) > 0 && !change.timestamp.After(merged[len(merged)-1].timestamp) {
+			continue
 		}
+		merged = append(merged, change)
 	}
+	return merged
+}
+
+// trimSpotPoints drops the prices superseded before start, sorted by time. The price in effect at start is kept.
+func trimSpotPoints(points []spotPoint, start time.Time) []spotPoint {
+	for len(points) > 1 && !points[1].timestamp.After(start) {
+		points = points[1:]
+	}
+	return points
+}
+
+type spotStats struct {
+	min, max, mean, stddev float64
+	changes                int
+}
+
+// spotHistoryStats summarizes the price changes of the window, sorted by time. Every price holds until the next change,
+// the mean and the standard deviation are weighted by how long it held. The first price may predate the window, it is
+// then counted from the window start, the prices superseded before the window are ignored.
+func spotHistoryStats(points []spotPoint, start, end time.Time) spotStats {
+	points = trimSpotPoints(points, start)
+	stats := spotStats{min: points[0].value, max: points[0].value}
+
+	var total, sum, sumSquares float64
+	for i, point := range points {
+		from := point.timestamp
+		if from.Before(start) {
+			from = start
+		}
+		to := end
+		if i+1 < len(points) {
+			to = points[i+1].timestamp
+		}
+		weight := to.Sub(from).Seconds()
+		if weight < 0 {
+			weight = 0
+		}
+
+		total += weight
+		sum += weight * point.value
+		sumSquares += weight * point.value * point.value
+
+		stats.min = math.Min(stats.min, point.value)
+		stats.max = math.Max(stats.max, point.value)
+		if i > 0 && point.value != points[i-1].value {
+			stats.changes++
+		}
+	}
+
+	if total == 0 {
+		stats.mean = points[len(points)-1].value
+		return stats
+	}
+	stats.mean = sum / total
+	stats.stddev = math.Sqrt(math.Max(sumSquares/total-stats.mean*stats.mean, 0))
+
+	return stats
 }
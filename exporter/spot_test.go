@@ -0,0 +1,121 @@
+package exporter
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpotHistoryStats(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	at := func(hours float64) time.Time {
+		return start.Add(time.Duration(hours * float64(time.Hour)))
+	}
+
+	tests := []struct {
+		name   string
+		points []spotPoint
+		want   spotStats
+	}{
+		{
+			name:   "single price",
+			points: []spotPoint{{timestamp: at(1), value: 0.04}},
+			want:   spotStats{min: 0.04, max: 0.04, mean: 0.04},
+		},
+		{
+			name: "weighted by duration",
+			points: []spotPoint{
+				{timestamp: at(0), value: 0.04},
+				{timestamp: at(3), value: 0.08},
+			},
+			// 3h at 0.04 and 1h at 0.08
+			want: spotStats{min: 0.04, max: 0.08, mean: 0.05, stddev: math.Sqrt(0.75*0.01*0.01 + 0.25*0.03*0.03), changes: 1},
+		},
+		{
+			name: "price before the window start",
+			points: []spotPoint{
+				{timestamp: at(-2), value: 0.04},
+				{timestamp: at(2), value: 0.06},
+			},
+			// the first price holds from the window start, 2h at 0.04 and 2h at 0.06
+			want: spotStats{min: 0.04, max: 0.06, mean: 0.05, stddev: 0.01, changes: 1},
+		},
+		{
+			name: "price superseded before the window start",
+			points: []spotPoint{
+				{timestamp: at(-3), value: 0.10},
+				{timestamp: at(-1), value: 0.04},
+				{timestamp: at(2), value: 0.06},
+			},
+			want: spotStats{min: 0.04, max: 0.06, mean: 0.05, stddev: 0.01, changes: 1},
+		},
+		{
+			name: "unchanged price",
+			points: []spotPoint{
+				{timestamp: at(0), value: 0.04},
+				{timestamp: at(2), value: 0.04},
+			},
+			want: spotStats{min: 0.04, max: 0.04, mean: 0.04},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := spotHistoryStats(tt.points, start, end)
+			if got.changes != tt.want.changes ||
+				!almostEqual(got.min, tt.want.min) || !almostEqual(got.max, tt.want.max) ||
+				!almostEqual(got.mean, tt.want.mean) || !almostEqual(got.stddev, tt.want.stddev) {
+				t.Errorf("spotHistoryStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSpotPoints(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+
+	tests := []struct {
+		name    string
+		known   []spotPoint
+		changes []spotPoint
+		trim    time.Time
+		want    []spotPoint
+	}{
+		{
+			name:    "first fetch",
+			changes: []spotPoint{{timestamp: at(0), value: 0.04}, {timestamp: at(1), value: 0.05}},
+			trim:    at(0),
+			want:    []spotPoint{{timestamp: at(0), value: 0.04}, {timestamp: at(1), value: 0.05}},
+		},
+		{
+			name:    "price in effect at the fetch start already known",
+			known:   []spotPoint{{timestamp: at(0), value: 0.04}, {timestamp: at(1), value: 0.05}},
+			changes: []spotPoint{{timestamp: at(1), value: 0.05}, {timestamp: at(3), value: 0.06}},
+			trim:    at(0),
+			want:    []spotPoint{{timestamp: at(0), value: 0.04}, {timestamp: at(1), value: 0.05}, {timestamp: at(3), value: 0.06}},
+		},
+		{
+			name:    "window moved",
+			known:   []spotPoint{{timestamp: at(0), value: 0.04}, {timestamp: at(1), value: 0.05}, {timestamp: at(3), value: 0.06}},
+			changes: []spotPoint{{timestamp: at(3), value: 0.06}, {timestamp: at(5), value: 0.07}},
+			trim:    at(2),
+			want:    []spotPoint{{timestamp: at(1), value: 0.05}, {timestamp: at(3), value: 0.06}, {timestamp: at(5), value: 0.07}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trimSpotPoints(mergeSpotPoints(tt.known, tt.changes), tt.trim)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged points = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
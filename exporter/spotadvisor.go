@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSpotAdvisorData is the URL the Spot Instance Advisor dataset is published at.
+const DefaultSpotAdvisorData = "https://spot-bid-advisor.s3.amazonaws.com/spot-advisor-data.json"
+
+// spotAdvisorData is the Spot Instance Advisor dataset (spot-advisor-data.json).
+type spotAdvisorData struct {
+	Ranges []struct {
+		Index int    `json:"index"`
+		Label string `json:"label"`
+	} `json:"ranges"`
+	// SpotAdvisor holds the savings over ondemand (%) and the interruption range of the instance types, by region and
+	// operating system
+	SpotAdvisor map[string]map[string]map[string]struct {
+		Savings int `json:"s"`
+		Range   int `json:"r"`
+	} `json:"spot_advisor"`
+}
+
+// spotAdvisorSource exports the interruption frequency and the savings over ondemand of the spot instances, from the
+// Spot Instance Advisor dataset.
+type spotAdvisorSource struct {
+	location         string
+	operatingSystems []string
+	instanceRegexes  []*regexp.Regexp
+	client           *http.Client
+
+	data *spotAdvisorData
+	// refreshedAt is the start of the refresh the dataset was downloaded in
+	refreshedAt time.Time
+	mtx         sync.Mutex
+}
+
+func init() {
+	RegisterPriceSource("spotadvisor", newSpotAdvisorSource)
+}
+
+func newSpotAdvisorSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("spotadvisor", cfg.SpotAdvisorData != "") {
+		return nil
+	}
+
+	location := cfg.SpotAdvisorData
+	if location == "" {
+		location = DefaultSpotAdvisorData
+	}
+
+	return &spotAdvisorSource{
+		location:         location,
+		operatingSystems: cfg.OperatingSystems,
+		instanceRegexes:  cfg.instanceRegexes,
+		client:           http.DefaultClient,
+	}
+}
+
+func (s *spotAdvisorSource) Name() string {
+	return "spotadvisor"
+}
+
+// Service returns the service of the offer files, the dataset is not read from an AWS API.
+func (s *spotAdvisorSource) Service() string {
+	return offersService
+}
+
+// FetchRegion returns the interruption range and the savings over ondemand of the instance types in the region, for
+// the configured operating systems (Linux, Windows).
+func (s *spotAdvisorSource) FetchRegion(ctx context.Context, _ aws.Config, region string) ([]PriceRecord, error) {
+	data, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[int]string, len(data.Ranges))
+	for _, r := range data.Ranges {
+		labels[r.Index] = r.Label
+	}
+
+	records := make([]PriceRecord, 0)
+	for os, instanceTypes := range data.SpotAdvisor[region] {
+		if !contains(s.operatingSystems, os) {
+			continue
+		}
+
+		for instanceType, advice := range instanceTypes {
+			if !isMatchAny(s.instanceRegexes, instanceType) {
+				log.Debugf("Skipping instance type: %s", instanceType)
+				continue
+			}
+
+			record := PriceRecord{
+				Name:                  "spot_interruption_bucket",
+				Value:                 float64(advice.Range),
+				Region:                region,
+				InstanceType:          instanceType,
+				OperatingSystem:       os,
+				InterruptionFrequency: labels[advice.Range],
+			}
+			savings := record
+			savings.Name = "spot_savings_over_ondemand_ratio"
+			savings.Value = float64(advice.Savings) / 100
+			savings.InterruptionFrequency = ""
+
+			records = append(records, record, savings)
+		}
+	}
+
+	return records, nil
+}
+
+// fetch returns the dataset, downloaded once per refresh and shared by its regions.
+func (s *spotAdvisorSource) fetch(ctx context.Context) (*spotAdvisorData, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	refreshedAt := refreshStart(ctx)
+	if s.data != nil && !refreshedAt.IsZero() && s.refreshedAt.Equal(refreshedAt) {
+		return s.data, nil
+	}
+
+	r, err := openLocation(ctx, s.client, s.location)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading spot advisor data: %w", err)
+	}
+	defer r.Close()
+
+	var data spotAdvisorData
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid spot advisor data: %w", err)
+	}
+
+	s.data = &data
+	s.refreshedAt = refreshedAt
+
+	return s.data, nil
+}
@@ -0,0 +1,193 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSpotPlacementInterval is how often the Spot placement scores are fetched again by default. AWS limits the
+// number of score configurations requested within 24 hours, so they are not fetched on every refresh.
+const DefaultSpotPlacementInterval = 24 * time.Hour
+
+// MaxSpotPlacementInstanceTypes is the maximum number of instance types of the Spot placement scores.
+const MaxSpotPlacementInstanceTypes = 10
+
+// spotPlacementScoreCache holds the last scores of every region, shared by the sources built on every configuration
+// reload so that a reload doesn't request the scores again.
+var spotPlacementScoreCache = &spotPlacementCache{scores: make(map[spotPlacementKey]spotPlacementScores)}
+
+// spotPlacementSource exports the Spot placement scores (1-10) of the configured instance types, telling how likely a
+// Spot request of the target capacity, diversified over the instance types, succeeds in the region or in each of its
+// availability zones.
+type spotPlacementSource struct {
+	instanceTypes    []string
+	targetCapacities []int32
+	interval         time.Duration
+	cache            *spotPlacementCache
+}
+
+// spotPlacementKey identifies the scores of a region, they are requested again when the instance types or the target
+// capacities change.
+type spotPlacementKey struct {
+	region           string
+	instanceTypes    string
+	targetCapacities string
+}
+
+type spotPlacementCache struct {
+	mu     sync.Mutex
+	scores map[spotPlacementKey]spotPlacementScores
+}
+
+type spotPlacementScores struct {
+	fetched time.Time
+	records []PriceRecord
+}
+
+func init() {
+	RegisterPriceSource("spotplacement", newSpotPlacementSource)
+}
+
+func newSpotPlacementSource(cfg Config) PriceSource {
+	if !cfg.SourceEnabled("spotplacement", len(cfg.SpotPlacementCapacities) != 0) {
+		return nil
+	}
+
+	targetCapacities := cfg.SpotPlacementCapacities
+	if len(targetCapacities) == 0 {
+		targetCapacities = defaultSpotPlacementCapacities
+	}
+
+	instanceTypes := append([]string{}, cfg.SpotPlacementInstanceTypes...)
+	sort.Strings(instanceTypes)
+
+	return &spotPlacementSource{
+		instanceTypes:    instanceTypes,
+		targetCapacities: targetCapacities,
+		interval:         cfg.SpotPlacementInterval,
+		cache:            spotPlacementScoreCache,
+	}
+}
+
+func (s *spotPlacementSource) Name() string {
+	return "spotplacement"
+}
+
+func (s *spotPlacementSource) Service() string {
+	return "ec2"
+}
+
+// FetchRegion returns the region and availability zone scores of the instance types for every target capacity. All the
+// instance types go in a single request, so every capacity takes two requests; they are fetched once per interval and
+// the cached ones are returned in between.
+func (s *spotPlacementSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	now := time.Now()
+	key := s.key(region)
+	if records, ok := s.cache.get(key, now, s.interval); ok {
+		log.Debugf("Using cached spot placement scores [region=%s]", region)
+		return records, nil
+	}
+
+	ec2Svc := ec2.NewFromConfig(cfg)
+
+	azs, err := getZones(ctx, ec2Svc, region, false)
+	if err != nil {
+		return nil, err
+	}
+	zones := make(map[string]string, len(azs))
+	for _, z := range azs {
+		zones[z.ID] = z.Name
+	}
+
+	records := make([]PriceRecord, 0)
+	for _, capacity := range s.targetCapacities {
+		for _, singleAZ := range []bool{false, true} {
+			scores, err := getSpotPlacementScores(ctx, ec2Svc, region, zones, s.instanceTypes, capacity, singleAZ)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, scores...)
+		}
+	}
+
+	s.cache.set(key, spotPlacementScores{fetched: now, records: records})
+
+	return records, nil
+}
+
+func (s *spotPlacementSource) key(region string) spotPlacementKey {
+	return spotPlacementKey{
+		region:           region,
+		instanceTypes:    strings.Join(s.instanceTypes, ","),
+		targetCapacities: fmt.Sprint(s.targetCapacities),
+	}
+}
+
+// get returns the scores fetched within the interval.
+func (c *spotPlacementCache) get(key spotPlacementKey, now time.Time, interval time.Duration) ([]PriceRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	scores, ok := c.scores[key]
+	if !ok || now.Sub(scores.fetched) >= interval {
+		return nil, false
+	}
+	return scores.records, true
+}
+
+func (c *spotPlacementCache) set(key spotPlacementKey, scores spotPlacementScores) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.scores[key] = scores
+}
+
+// getSpotPlacementScores returns the region or availability zone scores of a Spot request of the target capacity,
+// diversified over the instance types. The instance_type label of the scores lists all of them.
+func getSpotPlacementScores(ctx context.Context, ec2Svc *ec2.Client, region string, zones map[string]string, instanceTypes []string, capacity int32, singleAZ bool) ([]PriceRecord, error) {
+	pag := ec2.NewGetSpotPlacementScoresPaginator(ec2Svc, &ec2.GetSpotPlacementScoresInput{
+		InstanceTypes:          instanceTypes,
+		TargetCapacity:         aws.Int32(capacity),
+		TargetCapacityUnitType: ec2types.TargetCapacityUnitTypeUnits,
+		RegionNames:            []string{region},
+		SingleAvailabilityZone: aws.Bool(singleAZ),
+		MaxResults:             aws.Int32(AwsMaxResultsPerPage),
+	})
+
+	instanceType := strings.Join(instanceTypes, ",")
+	records := make([]PriceRecord, 0)
+	for pag.HasMorePages() {
+		page, err := pag.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error while fetching spot placement scores of %s: %w", instanceType, err)
+		}
+
+		for _, score := range page.SpotPlacementScores {
+			az := ""
+			if score.AvailabilityZoneId != nil {
+				az = zones[aws.ToString(score.AvailabilityZoneId)]
+			}
+			log.Debugf("Creating new metric: spot_placement_score{region=%s, az=%s, instance_type=%s, target_capacity=%d} = %d.", region, az, instanceType, capacity, aws.ToInt32(score.Score))
+
+			records = append(records, PriceRecord{
+				Name:             "spot_placement_score",
+				Value:            float64(aws.ToInt32(score.Score)),
+				Region:           region,
+				AvailabilityZone: az,
+				InstanceType:     instanceType,
+				TargetCapacity:   int(capacity),
+			})
+		}
+	}
+
+	return records, nil
+}
@@ -0,0 +1,48 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpotPlacementCacheSurvivesReload(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := Config{
+		SpotPlacementCapacities:    []int32{1, 10},
+		SpotPlacementInstanceTypes: []string{"m5.large", "c5.large"},
+		SpotPlacementInterval:      24 * time.Hour,
+	}
+	cache := &spotPlacementCache{scores: make(map[spotPlacementKey]spotPlacementScores)}
+	source := func(cfg Config) *spotPlacementSource {
+		s := newSpotPlacementSource(cfg).(*spotPlacementSource)
+		s.cache = cache
+		return s
+	}
+
+	first := source(cfg)
+	cache.set(first.key("eu-west-1"), spotPlacementScores{fetched: now, records: []PriceRecord{{Name: "spot_placement_score", Value: 7}}})
+
+	reordered := cfg
+	reordered.SpotPlacementInstanceTypes = []string{"c5.large", "m5.large"}
+	changed := cfg
+	changed.SpotPlacementCapacities = []int32{1}
+
+	tests := []struct {
+		name   string
+		source *spotPlacementSource
+		at     time.Time
+		want   bool
+	}{
+		{name: "same config", source: source(cfg), at: now.Add(time.Hour), want: true},
+		{name: "same instance types in another order", source: source(reordered), at: now.Add(time.Hour), want: true},
+		{name: "other capacities", source: source(changed), at: now.Add(time.Hour), want: false},
+		{name: "interval elapsed", source: source(cfg), at: now.Add(24 * time.Hour), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := cache.get(tt.source.key("eu-west-1"), tt.at, tt.source.interval); ok != tt.want {
+				t.Errorf("cached = %t, want %t", ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Error classes of failed fetches, exposed in the class label of aws_pricing_source_errors_total.
+const (
+	errorClassThrottling     = "throttling"
+	errorClassAccessDenied   = "access_denied"
+	errorClassInvalidRequest = "invalid_request"
+	errorClassService        = "service_error"
+	errorClassTimeout        = "timeout"
+	errorClassOther          = "other"
+)
+
+var errorClasses = map[string]string{
+	"Throttling":                             errorClassThrottling,
+	"ThrottlingException":                    errorClassThrottling,
+	"ThrottledException":                     errorClassThrottling,
+	"RequestThrottled":                       errorClassThrottling,
+	"RequestThrottledException":              errorClassThrottling,
+	"RequestLimitExceeded":                   errorClassThrottling,
+	"TooManyRequestsException":               errorClassThrottling,
+	"ProvisionedThroughputExceededException": errorClassThrottling,
+	"LimitExceededException":                 errorClassThrottling,
+	"SlowDown":                               errorClassThrottling,
+	"AccessDenied":                           errorClassAccessDenied,
+	"AccessDeniedException":                  errorClassAccessDenied,
+	"UnauthorizedOperation":                  errorClassAccessDenied,
+	"UnrecognizedClientException":            errorClassAccessDenied,
+	"AuthFailure":                            errorClassAccessDenied,
+	"InvalidClientTokenId":                   errorClassAccessDenied,
+	"ExpiredToken":                           errorClassAccessDenied,
+	"ExpiredTokenException":                  errorClassAccessDenied,
+	"SignatureDoesNotMatch":                  errorClassAccessDenied,
+	"OptInRequired":                          errorClassAccessDenied,
+	"ValidationException":                    errorClassInvalidRequest,
+	"InvalidParameterException":              errorClassInvalidRequest,
+	"InvalidParameterValue":                  errorClassInvalidRequest,
+	"InvalidParameterCombination":            errorClassInvalidRequest,
+	"InvalidNextTokenException":              errorClassInvalidRequest,
+	"NotFoundException":                      errorClassInvalidRequest,
+	"InternalError":                          errorClassService,
+	"InternalErrorException":                 errorClassService,
+	"InternalFailure":                        errorClassService,
+	"InternalServerError":                    errorClassService,
+	"ServiceUnavailable":                     errorClassService,
+	"ServiceUnavailableException":            errorClassService,
+	"Unavailable":                            errorClassService,
+}
+
+// classifyError returns the class and the AWS error code of a failed fetch. Errors not returned by the AWS API have an empty code.
+func classifyError(err error) (string, string) {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		if class, ok := errorClasses[code]; ok {
+			return class, code
+		}
+		if apiErr.ErrorFault() == smithy.FaultServer {
+			return errorClassService, code
+		}
+		return errorClassOther, code
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return errorClassTimeout, ""
+	}
+
+	return errorClassOther, ""
+}
+
+// sourceMetrics exposes the outcome of the fetches of every source in every region.
+type sourceMetrics struct {
+	errors      *prometheus.CounterVec
+	lastSuccess *prometheus.GaugeVec
+	duration    *prometheus.GaugeVec
+	records     *prometheus.GaugeVec
+}
+
+func newSourceMetrics() *sourceMetrics {
+	return &sourceMetrics{
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "aws_pricing",
+			Name:      "source_errors_total",
+			Help:      "Total failed fetches of the source in the region, by error class and AWS error code.",
+		}, []string{"source", "region", "class", "code"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "source_last_success_timestamp_seconds",
+			Help:      "Unix timestamp of the last successful fetch of the source in the region.",
+		}, []string{"source", "region"}),
+		duration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "source_duration_seconds",
+			Help:      "Duration of the last fetch of the source in the region.",
+		}, []string{"source", "region"}),
+		records: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "aws_pricing",
+			Name:      "source_records",
+			Help:      "Number of records returned by the last successful fetch of the source in the region.",
+		}, []string{"source", "region"}),
+	}
+}
+
+// observe records the outcome of a fetch started at start.
+func (m *sourceMetrics) observe(source, region string, start time.Time, records int, err error) {
+	m.duration.WithLabelValues(source, region).Set(time.Since(start).Seconds())
+
+	if err != nil {
+		class, code := classifyError(err)
+		m.errors.WithLabelValues(source, region, class, code).Inc()
+		return
+	}
+
+	m.lastSuccess.WithLabelValues(source, region).SetToCurrentTime()
+	m.records.WithLabelValues(source, region).Set(float64(records))
+}
+
+func (m *sourceMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.errors.Describe(ch)
+	m.lastSuccess.Describe(ch)
+	m.duration.Describe(ch)
+	m.records.Describe(ch)
+}
+
+func (m *sourceMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.errors.Collect(ch)
+	m.lastSuccess.Collect(ch)
+	m.duration.Collect(ch)
+	m.records.Collect(ch)
+}
@@ -21,7 +21,7 @@ type SKU struct {
 	Sku             string
 	EffectiveDate   string
 	OfferTermCode   string
-	TermAttributes  string
+	TermAttributes  map[string]string
 }
 
 type Details struct {
@@ -34,7 +34,24 @@ type Details struct {
 	PricePerUnit map[string]string
 }
 
+// Instance holds the hardware of an instance type, from the DescribeInstanceTypes catalog.
 type Instance struct {
 	Memory int64
 	VCpu   int32
+	// Architecture is the comma separated list of supported architectures (e.g. x86_64,i386)
+	Architecture string
+	GPUs         int32
+	GPUModel     string
+	// GPUMemory is the total memory of the GPUs in MiB
+	GPUMemory          int32
+	NetworkPerformance string
+	// EBSBandwidth is the baseline EBS bandwidth in Mbps
+	EBSBandwidth int32
+	// InstanceStorage is the total size of the local instance storage in GB
+	InstanceStorage   int64
+	Burstable         bool
+	Hypervisor        string
+	CurrentGeneration bool
+	// Virtualization is the comma separated list of supported virtualization types (hvm, paravirtual)
+	Virtualization string
 }
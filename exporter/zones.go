@@ -0,0 +1,127 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	zoneTypeAvailabilityZone = "availability-zone"
+	zoneTypeLocalZone        = "local-zone"
+)
+
+// zone is an availability zone of a region, or a Local Zone attached to it.
+type zone struct {
+	// Name is the zone name (us-east-1a), mapped to a different physical zone in every account
+	Name string
+	// ID is the zone ID (use1-az1), the same physical zone in every account
+	ID string
+	// Type is availability-zone, local-zone or wavelength-zone
+	Type string
+	// ParentZone is the availability zone a Local Zone is attached to, empty for an availability zone
+	ParentZone string
+	// Group is the zone group, the region for the availability zones and e.g. us-west-2-lax-1 for a Local Zone
+	Group string
+}
+
+// zonesSource exports an info metric of the availability zones of the regions, with the zone ID, type and group the
+// availability_zone label of the prices can be joined with.
+type zonesSource struct {
+	localZones bool
+}
+
+func init() {
+	RegisterPriceSource("zones", newZonesSource)
+}
+
+func newZonesSource(cfg Config) PriceSource {
+	// the offline mode doesn't need AWS access for the ondemand prices, the zones are opt-in there
+	if !cfg.SourceEnabled("zones", cfg.OfferFiles == "") {
+		return nil
+	}
+
+	return &zonesSource{
+		localZones: cfg.LocalZones,
+	}
+}
+
+func (s *zonesSource) Name() string {
+	return "zones"
+}
+
+func (s *zonesSource) Service() string {
+	return "ec2"
+}
+
+// FetchRegion returns an info record of every availability zone of the region, and of its opted-in Local Zones when
+// enabled.
+func (s *zonesSource) FetchRegion(ctx context.Context, cfg aws.Config, region string) ([]PriceRecord, error) {
+	zones, err := getZones(ctx, ec2.NewFromConfig(cfg), region, s.localZones)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]PriceRecord, 0, len(zones))
+	for _, z := range zones {
+		log.Debugf("Creating new metric: availability_zone_info{region=%s, az=%s, zone_id=%s, zone_type=%s}.", region, z.Name, z.ID, z.Type)
+
+		records = append(records, PriceRecord{
+			Name:             "availability_zone_info",
+			Value:            1,
+			Region:           region,
+			AvailabilityZone: z.Name,
+			ZoneID:           z.ID,
+			ZoneType:         z.Type,
+			ParentZone:       z.ParentZone,
+			ZoneGroup:        z.Group,
+		})
+	}
+
+	return records, nil
+}
+
+// getZones returns the availability zones of the region and, with localZones, its opted-in Local Zones.
+func getZones(ctx context.Context, ec2Svc *ec2.Client, region string, localZones bool) ([]zone, error) {
+	resp, err := ec2Svc.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
+		Filters: []ec2types.Filter{
+			{
+				Name:   aws.String("region-name"),
+				Values: []string{region},
+			},
+		}})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't describe AZs in %s: %w", region, err)
+	}
+
+	zones := make([]zone, 0, len(resp.AvailabilityZones))
+	for _, az := range resp.AvailabilityZones {
+		zoneType := aws.ToString(az.ZoneType)
+		if zoneType != zoneTypeAvailabilityZone && !(localZones && zoneType == zoneTypeLocalZone) {
+			continue
+		}
+
+		zones = append(zones, zone{
+			Name:       aws.ToString(az.ZoneName),
+			ID:         aws.ToString(az.ZoneId),
+			Type:       zoneType,
+			ParentZone: aws.ToString(az.ParentZoneName),
+			Group:      aws.ToString(az.GroupName),
+		})
+	}
+
+	return zones, nil
+}
+
+// zoneNames returns the names of the zones.
+func zoneNames(zones []zone) []string {
+	names := make([]string, len(zones))
+	for i, z := range zones {
+		names[i] = z.Name
+	}
+	return names
+}
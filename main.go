@@ -5,12 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
-	"regexp"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/pixelfederation/ec2-price-exporter/exporter"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -18,16 +19,41 @@ import (
 )
 
 var (
-	addr                = flag.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
-	metricsPath         = flag.String("metrics-path", "/metrics", "path to metrics endpoint")
-	rawLevel            = flag.String("log-level", "info", "log level")
-	productDescriptions = flag.String("product-descriptions", "Linux/UNIX", "Comma separated list of product descriptions, used to filter spot instances. Accepted values: Linux/UNIX, SUSE Linux, Windows, Linux/UNIX (Amazon VPC), SUSE Linux (Amazon VPC), Windows (Amazon VPC)")
-	operatingSystems    = flag.String("operating-systems", "Linux", "Comma separated list of operating systems, used to filter ondemand instances. Accepted values: Linux, RHEL, SUSE, Windows")
-	regions             = flag.String("regions", "", "Comma separated list of AWS regions to get pricing for (defaults to *all*)")
-	lifecycle           = flag.String("lifecycle", "", "Comma separated list of Lifecycles (spot or ondemand) to get pricing for (defaults to *all*)")
-	cache               = flag.Int("cache", 0, "How long should the results be cached, in seconds (defaults to *0*)")
-	instanceRegexes     = flag.String("instance-regexes", "", "Comma separated list of instance types regexes (defaults to *all*)")
-	savingPlanTypes     = flag.String("saving-plan-types", "", "Comma separated list of saving plans types (defaults to *none)")
+	addr                 = flag.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
+	metricsPath          = flag.String("metrics-path", "/metrics", "path to metrics endpoint")
+	rawLevel             = flag.String("log-level", "info", "log level")
+	configFile           = flag.String("config.file", "", "Path to a YAML configuration file, its settings override the flags. Reloaded on SIGHUP or a POST to /-/reload")
+	productDescriptions  = flag.String("product-descriptions", "Linux/UNIX", "Comma separated list of product descriptions, used to filter spot instances. Accepted values: Linux/UNIX, SUSE Linux, Windows, Linux/UNIX (Amazon VPC), SUSE Linux (Amazon VPC), Windows (Amazon VPC)")
+	operatingSystems     = flag.String("operating-systems", "Linux", "Comma separated list of operating systems, used to filter ondemand instances. Accepted values: Linux, RHEL, SUSE, Windows")
+	preInstalledSw       = flag.String("pre-installed-software", "NA", "Comma separated list of software pre-installed on the ondemand and reserved instances. Accepted values: NA, SQL Std, SQL Web, SQL Ent")
+	licenseModels        = flag.String("license-models", "", "Comma separated list of license models of the ondemand and reserved instances. Accepted values: No License required, License Included, Bring your own license (defaults to *all*)")
+	tenancies            = flag.String("tenancies", "Shared", "Comma separated list of tenancies of the ondemand, reserved and saving plan prices. Accepted values: Shared, Dedicated, Host")
+	capacityStatuses     = flag.String("capacity-statuses", "Used", "Comma separated list of capacity statuses of the ondemand and reserved prices. Accepted values: Used, UnusedCapacityReservation, AllocatedCapacityReservation")
+	regions              = flag.String("regions", "", "Comma separated list of AWS regions to get pricing for (defaults to *all*)")
+	lifecycle            = flag.String("lifecycle", "", "Comma separated list of Lifecycles (spot, ondemand or reserved) to get pricing for (defaults to *spot,ondemand*)")
+	refreshInterval      = flag.Duration("refresh-interval", 5*time.Minute, "How often should the prices be refreshed from AWS in the background")
+	instanceRegexes      = flag.String("instance-regexes", "", "Comma separated list of instance types regexes (defaults to *all*)")
+	savingPlanTypes      = flag.String("saving-plan-types", "", "Comma separated list of saving plans types (defaults to *none)")
+	ebsVolumeTypes       = flag.String("ebs-volume-types", "", "Comma separated list of EBS volume types to get pricing for. Accepted values: gp2, gp3, io1, io2, st1, sc1, standard (defaults to *none*)")
+	fargate              = flag.Bool("fargate", false, "Get pricing for the Fargate vCPU and memory")
+	spotPlacementCaps    = flag.String("spot-placement-capacities", "", "Comma separated list of target capacities (number of instances) to get Spot placement scores for (defaults to *none*)")
+	spotPlacementTypes   = flag.String("spot-placement-instance-types", "", "Comma separated list of instance types to get Spot placement scores for, required with -spot-placement-capacities (at most 10)")
+	spotPlacementEvery   = flag.Duration("spot-placement-interval", exporter.DefaultSpotPlacementInterval, "How often should the Spot placement scores be refreshed from AWS, AWS limits the score requests per 24 hours")
+	spotAdvisorData      = flag.String("spot-advisor-data", "", "URL or path of the Spot Instance Advisor dataset, e.g. "+exporter.DefaultSpotAdvisorData+" (defaults to *disabled*)")
+	spotHistoryWindow    = flag.Duration("spot-history-window", 0, "Lookback window of the spot price statistics, e.g. 24h or 168h (defaults to *disabled*)")
+	legacyLabels         = flag.Bool("legacy-labels", true, "Keep the product_description and operating_system labels next to the platform label")
+	partitionProfiles    = flag.String("partition-profiles", "", "Comma separated list of partition=profile pairs, the AWS shared config profiles holding the credentials of the partitions (aws, aws-cn, aws-us-gov) (defaults to the default credentials)")
+	localZones           = flag.Bool("local-zones", false, "Include the opted-in Local Zones in the availability zones of the regions")
+	onDemandRegionOnly   = flag.Bool("ondemand-region-only", false, "Export the ondemand prices per region only, without availability zones")
+	normalizationModel   = flag.String("normalization-model", exporter.NormalizationRatio, "Model splitting the instance prices between vcpu, memory and GPUs. Accepted values: ratio, fitted, gpu")
+	cpuMemoryRatio       = flag.Float64("cpu-memory-ratio", exporter.DefaultCPUMemoryRatio, "Cost of a vcpu in GB of memory, used by the ratio normalization model and when a region can't be fitted")
+	instanceTypesRefresh = flag.Duration("instance-types-refresh-interval", exporter.DefaultInstanceTypesRefreshInterval, "How often should the instance type catalog of every region be refreshed from AWS")
+	maxStaleness         = flag.Duration("max-staleness", 24*time.Hour, "How long should the last good prices of a region be served when its fetches fail (0 to serve them forever)")
+	snapshotFile         = flag.String("snapshot.file", "", "Path of the file the prices are persisted to after every refresh and served from at startup (defaults to *disabled*)")
+	offerFiles           = flag.String("offer-files", "", "Directory or URL of the AWS Price List bulk offer files of AmazonEC2 (holding region_index.json), read instead of the Pricing API for ondemand prices")
+	offerFilesFormat     = flag.String("offer-files-format", "json", "Format of the region offer files: json or csv")
+	concurrency          = flag.Int("concurrency", 10, "Maximum number of concurrent region fetches")
+	serviceConcurrency   = flag.String("service-concurrency", "pricing=2", "Comma separated list of service=limit pairs, limiting the concurrent fetches per AWS service (ec2, pricing, savingsplans)")
 )
 
 func init() {
@@ -42,65 +68,108 @@ func init() {
 }
 
 func main() {
-	log.Infof("Starting AWS EC2 Price exporter. [log-level=%s, regions=%s, product-descriptions=%s, operating-systems=%s, cache=%d, lifecycle=%s, instance-regexes=%s, saving-plan-types=%s]", *rawLevel, *regions, *productDescriptions, *operatingSystems, *cache, *lifecycle, *instanceRegexes, *savingPlanTypes)
+	log.Infof("Starting AWS EC2 Price exporter. [log-level=%s, config-file=%s, regions=%s, product-descriptions=%s, operating-systems=%s, pre-installed-software=%s, license-models=%s, tenancies=%s, capacity-statuses=%s, refresh-interval=%s, instance-types-refresh-interval=%s, max-staleness=%s, lifecycle=%s, instance-regexes=%s, saving-plan-types=%s, ebs-volume-types=%s, fargate=%t, spot-placement-capacities=%s, spot-placement-instance-types=%s, spot-placement-interval=%s, spot-advisor-data=%s, spot-history-window=%s, legacy-labels=%t, partition-profiles=%s, local-zones=%t, ondemand-region-only=%t, normalization-model=%s, cpu-memory-ratio=%v, concurrency=%d, service-concurrency=%s, snapshot-file=%s, offer-files=%s, offer-files-format=%s]", *rawLevel, *configFile, *regions, *productDescriptions, *operatingSystems, *preInstalledSw, *licenseModels, *tenancies, *capacityStatuses, *refreshInterval, *instanceTypesRefresh, *maxStaleness, *lifecycle, *instanceRegexes, *savingPlanTypes, *ebsVolumeTypes, *fargate, *spotPlacementCaps, *spotPlacementTypes, *spotPlacementEvery, *spotAdvisorData, *spotHistoryWindow, *legacyLabels, *partitionProfiles, *localZones, *onDemandRegionOnly, *normalizationModel, *cpuMemoryRatio, *concurrency, *serviceConcurrency, *snapshotFile, *offerFiles, *offerFilesFormat)
 
-	var reg []string
-	if len(*regions) == 0 {
-		cfg, err := config.LoadDefaultConfig(context.TODO())
-		if err != nil {
-			log.WithError(err).Errorf("error while initializing aws client to list available regions")
-			return
-		}
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		ec2Svc := ec2.NewFromConfig(cfg)
-		r, err := ec2Svc.DescribeRegions(context.TODO(), &ec2.DescribeRegionsInput{AllRegions: aws.Bool(false)})
+	ctx := context.Background()
+	exporter, err := exporter.NewExporter(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	prometheus.MustRegister(exporter)
+	go exporter.Run(ctx)
+
+	reload := func() error {
+		cfg, err := loadConfig()
 		if err != nil {
-			log.Fatal(err)
-			return
+			return err
 		}
-
-		for _, region := range r.Regions {
-			reg = append(reg, *region.RegionName)
+		if err := exporter.ApplyConfig(ctx, cfg); err != nil {
+			return err
 		}
-	} else {
-		reg = splitAndTrim(*regions)
+		log.Info("Configuration reloaded")
+		return nil
 	}
 
-	pds := splitAndTrim(*productDescriptions)
-	oss := splitAndTrim(*operatingSystems)
-	lc := splitAndTrim(*lifecycle)
-	if len(lc) == 0 {
-		lc = []string{"spot", "ondemand"}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reload(); err != nil {
+				log.WithError(err).Error("error while reloading configuration")
+			}
+		}
+	}()
+
+	log.Infof("Starting metric http endpoint [address=%s, path=%s]", *addr, *metricsPath)
+	http.Handle(*metricsPath, promhttp.Handler())
+	http.HandleFunc("/-/ready", readyHandler(exporter))
+	http.HandleFunc("/-/reload", reloadHandler(reload))
+	http.HandleFunc("/", rootHandler)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// loadConfig builds the exporter configuration from the flags, overlaid by the config file when one is given.
+func loadConfig() (exporter.Config, error) {
+	svcConc, err := parseServiceConcurrency(splitAndTrim(*serviceConcurrency))
+	if err != nil {
+		return exporter.Config{}, err
 	}
-	instReg := splitAndTrim(*instanceRegexes)
-	if len(instReg) == 0 {
-		instReg = []string{".*"}
+	placementCaps, err := parseCapacities(splitAndTrim(*spotPlacementCaps))
+	if err != nil {
+		return exporter.Config{}, err
 	}
-
-	instRegCompiled, err := compileRegexes(instReg)
+	profiles, err := parsePartitionProfiles(splitAndTrim(*partitionProfiles))
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		return
+		return exporter.Config{}, err
 	}
 
-	spt := splitAndTrim(*savingPlanTypes)
-
-	validateProductDesc(pds)
-	validateOperatingSystems(oss)
-	validateSavingPlanTypes(spt)
-
-	exporter.NewExporter(pds, oss, reg, lc, *cache, instRegCompiled, spt)
+	cfg := exporter.Config{
+		ProductDescriptions:          splitAndTrim(*productDescriptions),
+		OperatingSystems:             splitAndTrim(*operatingSystems),
+		PreInstalledSoftware:         splitAndTrim(*preInstalledSw),
+		LicenseModels:                splitAndTrim(*licenseModels),
+		Tenancies:                    splitAndTrim(*tenancies),
+		CapacityStatuses:             splitAndTrim(*capacityStatuses),
+		Regions:                      splitAndTrim(*regions),
+		Lifecycle:                    splitAndTrim(*lifecycle),
+		InstanceRegexes:              splitAndTrim(*instanceRegexes),
+		SavingPlanTypes:              splitAndTrim(*savingPlanTypes),
+		EBSVolumeTypes:               splitAndTrim(*ebsVolumeTypes),
+		Fargate:                      *fargate,
+		SpotPlacementCapacities:      placementCaps,
+		SpotPlacementInstanceTypes:   splitAndTrim(*spotPlacementTypes),
+		SpotPlacementInterval:        *spotPlacementEvery,
+		SpotAdvisorData:              *spotAdvisorData,
+		SpotHistoryWindow:            *spotHistoryWindow,
+		LegacyLabels:                 *legacyLabels,
+		PartitionProfiles:            profiles,
+		LocalZones:                   *localZones,
+		OnDemandRegionOnly:           *onDemandRegionOnly,
+		NormalizationModel:           *normalizationModel,
+		CPUMemoryRatio:               *cpuMemoryRatio,
+		RefreshInterval:              *refreshInterval,
+		InstanceTypesRefreshInterval: *instanceTypesRefresh,
+		MaxStaleness:                 *maxStaleness,
+		Concurrency:                  *concurrency,
+		ServiceConcurrency:           svcConc,
+		SnapshotFile:                 *snapshotFile,
+		OfferFiles:                   *offerFiles,
+		OfferFilesFormat:             *offerFilesFormat,
+	}
 
-	exporter, err := exporter.NewExporter(pds, oss, reg, lc, *cache, instRegCompiled, spt)
-	if err != nil {
-		log.Fatal(err)
+	if *configFile != "" {
+		return exporter.LoadConfigFile(*configFile, cfg)
 	}
-	prometheus.MustRegister(exporter)
 
-	log.Infof("Starting metric http endpoint [address=%s, path=%s]", *addr, *metricsPath)
-	http.Handle(*metricsPath, promhttp.Handler())
-	http.HandleFunc("/", rootHandler)
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	if err := cfg.Validate(); err != nil {
+		return exporter.Config{}, err
+	}
+	return cfg, nil
 }
 
 func splitAndTrim(str string) []string {
@@ -114,59 +183,84 @@ func splitAndTrim(str string) []string {
 	return parts
 }
 
-func validateProductDesc(pds []string) {
-	for _, desc := range pds {
-		if desc != "Linux/UNIX" && desc != "Linux/UNIX (Amazon VPC)" &&
-			desc != "SUSE Linux" && desc != "SUSE Linux (Amazon VPC)" &&
-			desc != "Windows" && desc != "Windows (Amazon VPC)" {
-			log.Fatalf("product description '%s' is not recognized. Available product descriptions: Linux/UNIX, SUSE Linux, Windows, Linux/UNIX (Amazon VPC), SUSE Linux (Amazon VPC), Windows (Amazon VPC)", desc)
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`<html>
+		<head><title>AWS EC2 Price Exporter</title></head>
+		<body>
+		<h1>AWS EC2 Price Exporter</h1>
+		<p><a href="` + *metricsPath + `">Metrics</a></p>
+		</body>
+		</html>
+	`))
+
+}
+
+func readyHandler(e *exporter.Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !e.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Waiting for the first price refresh.\n"))
+			return
 		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Ready.\n"))
 	}
 }
 
-func validateOperatingSystems(oss []string) {
-	for _, os := range oss {
-		if os != "Linux" &&
-			os != "RHEL" &&
-			os != "SUSE" &&
-			os != "Windows" {
-			log.Fatalf("Operating System '%s' is not recognized. Available operating system: Linux, RHEL, SUSE, Windows", os)
+func reloadHandler(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Only POST or PUT requests allowed.\n"))
+			return
 		}
+		if err := reload(); err != nil {
+			log.WithError(err).Error("error while reloading configuration")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(fmt.Sprintf("Failed to reload config: %s\n", err)))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
 	}
 }
 
-func validateSavingPlanTypes(spt []string) {
-	for _, plan := range spt {
-		if plan != "" &&
-			plan != "Compute" &&
-			plan != "EC2Instance" &&
-			plan != "SageMaker" {
-			log.Fatalf("SavingPlan type '%s' is not recognized. Available SavingPlans types: Compute, EC2Instance, SageMaker", plan)
+func parseServiceConcurrency(pairs []string) (map[string]int, error) {
+	limits := make(map[string]int, len(pairs))
+	for _, pair := range pairs {
+		service, rawLimit, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid service concurrency %s: expected service=limit", pair)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(rawLimit))
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid service concurrency %s: limit must be a positive number", pair)
 		}
+		limits[strings.TrimSpace(service)] = limit
 	}
+	return limits, nil
 }
 
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`<html>
-		<head><title>AWS EC2 Price Exporter</title></head>
-		<body>
-		<h1>AWS EC2 Price Exporter</h1>
-		<p><a href="` + *metricsPath + `">Metrics</a></p>
-		</body>
-		</html>
-	`))
-
+func parsePartitionProfiles(pairs []string) (map[string]string, error) {
+	profiles := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		partition, profile, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(profile) == "" {
+			return nil, fmt.Errorf("invalid partition profile %s: expected partition=profile", pair)
+		}
+		profiles[strings.TrimSpace(partition)] = strings.TrimSpace(profile)
+	}
+	return profiles, nil
 }
 
-func compileRegexes(regexes []string) ([]*regexp.Regexp, error) {
-	compiledRegexes := make([]*regexp.Regexp, len(regexes))
-	for i, r := range regexes {
-		re, err := regexp.Compile(r)
-		if err != nil {
-			return nil, fmt.Errorf("invalid regex %s: %s", r, err)
+func parseCapacities(values []string) ([]int32, error) {
+	capacities := make([]int32, 0, len(values))
+	for _, value := range values {
+		capacity, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || capacity <= 0 {
+			return nil, fmt.Errorf("invalid target capacity %s: must be a positive number", value)
 		}
-		compiledRegexes[i] = re
+		capacities = append(capacities, int32(capacity))
 	}
-	return compiledRegexes, nil
+	return capacities, nil
 }